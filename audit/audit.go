@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Finding is a vulnerability that affects the version of a module we use
+type Finding struct {
+	Module  string
+	Version string
+	Entry   *Entry
+	// Packages are the vulnerable packages we use. This is empty if the whole module is vulnerable.
+	Packages []string
+	// Fixed is the earliest version that fixes the vulnerability, or empty if there isn't one
+	Fixed string
+}
+
+func (f *Finding) String() string {
+	ret := fmt.Sprintf("%s@%s: %s", f.Module, f.Version, f.Entry.ID)
+	if f.Entry.Summary != "" {
+		ret += " " + f.Entry.Summary
+	}
+	if len(f.Packages) > 0 {
+		ret += fmt.Sprintf(" (in %s)", strings.Join(f.Packages, ", "))
+	}
+	if f.Fixed != "" {
+		ret += fmt.Sprintf(", fixed in %s", f.Fixed)
+	} else {
+		ret += ", not fixed yet"
+	}
+	return ret
+}
+
+// Check returns the vulnerabilities that affect the version of the module. Vulnerabilities that are only in specific
+// packages are only reported if used returns true for one of them, e.g. because we install or import it.
+func (db *Database) Check(module, version string, used func(pkg string) bool) []*Finding {
+	var ret []*Finding
+	for _, entry := range db.Entries(module) {
+		for i := range entry.Affected {
+			a := &entry.Affected[i]
+			if a.Package.Name != module || !a.affects(version) {
+				continue
+			}
+
+			f := &Finding{Module: module, Version: version, Entry: entry, Fixed: a.fixedAfter(version)}
+			for _, pkg := range a.EcosystemSpecific.Imports {
+				if used(pkg.Path) {
+					f.Packages = append(f.Packages, pkg.Path)
+				}
+			}
+			if len(a.EcosystemSpecific.Imports) > 0 && len(f.Packages) == 0 {
+				continue
+			}
+			sort.Strings(f.Packages)
+			ret = append(ret, f)
+			break
+		}
+	}
+	return ret
+}
+
+// FixVersion returns the earliest version of the module that fixes all the vulnerabilities in the findings, without
+// being affected by any others we'd use. It returns an empty string if any of them aren't fixed yet.
+func (db *Database) FixVersion(module string, findings []*Finding, used func(pkg string) bool) string {
+	version := ""
+	for len(findings) > 0 {
+		for _, f := range findings {
+			if f.Fixed == "" {
+				return ""
+			}
+			if version == "" || semver.Compare(f.Fixed, version) > 0 {
+				version = f.Fixed
+			}
+		}
+		// The fixed version might be affected by another vulnerability, so keep going until we find one that isn't
+		findings = db.Check(module, version, used)
+	}
+	return version
+}
@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var entries = map[string]string{
+	"ID/GO-2024-0001.json": `{
+		"id": "GO-2024-0001",
+		"summary": "Panic parsing headers",
+		"affected": [{
+			"package": {"ecosystem": "Go", "name": "example.com/foo"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.2.0"}, {"introduced": "1.3.0"}, {"fixed": "1.3.1"}]}],
+			"ecosystem_specific": {"imports": [{"path": "example.com/foo/headers"}]}
+		}]
+	}`,
+	"ID/GO-2024-0002.json": `{
+		"id": "GO-2024-0002",
+		"affected": [{
+			"package": {"ecosystem": "Go", "name": "example.com/foo"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "1.2.0"}, {"fixed": "1.4.0"}]}],
+			"ecosystem_specific": {"imports": [{"path": "example.com/foo/cookies"}]}
+		}]
+	}`,
+	"ID/GO-2024-0003.json": `{
+		"id": "GO-2024-0003",
+		"affected": [{
+			"package": {"ecosystem": "Go", "name": "example.com/bar"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}]
+		}]
+	}`,
+	"ID/GO-2024-0004.json": `{
+		"id": "GO-2024-0004",
+		"withdrawn": "2024-01-01T00:00:00Z",
+		"affected": [{
+			"package": {"ecosystem": "Go", "name": "example.com/bar"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}]
+		}]
+	}`,
+	"index/modules.json": `[{"path": "example.com/foo"}]`,
+}
+
+func writeDir(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range entries {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func writeZip(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "vulndb.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for name, content := range entries {
+		entry, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = entry.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	return path
+}
+
+func usedPackages(pkgs ...string) func(string) bool {
+	return func(pkg string) bool {
+		for _, p := range pkgs {
+			if p == pkg {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestLoadDatabase(t *testing.T) {
+	for _, path := range []string{writeDir(t), writeZip(t)} {
+		db, err := LoadDatabase(path)
+		require.NoError(t, err)
+		require.Len(t, db.Entries("example.com/foo"), 2)
+		require.Len(t, db.Entries("example.com/bar"), 1)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db, err := LoadDatabase(writeDir(t))
+	require.NoError(t, err)
+
+	findings := db.Check("example.com/foo", "v1.1.0", usedPackages("example.com/foo/headers"))
+	require.Len(t, findings, 1)
+	require.Equal(t, "example.com/foo@v1.1.0: GO-2024-0001 Panic parsing headers (in example.com/foo/headers), fixed in v1.2.0", findings[0].String())
+
+	// Pseudo-versions before the first release are affected too
+	require.Len(t, db.Check("example.com/foo", "v0.0.0-20200101000000-abcdefabcdef", usedPackages("example.com/foo/headers")), 1)
+
+	// We don't use the vulnerable package
+	require.Empty(t, db.Check("example.com/foo", "v1.1.0", usedPackages("example.com/foo/cookies")))
+	require.Empty(t, db.Check("example.com/foo", "v1.2.0", usedPackages("example.com/foo/headers")))
+	require.Len(t, db.Check("example.com/foo", "v1.3.0", usedPackages("example.com/foo/headers")), 1)
+
+	// Vulnerabilities without packages affect the whole module
+	findings = db.Check("example.com/bar", "v1.0.0", usedPackages())
+	require.Len(t, findings, 1)
+	require.Equal(t, "", findings[0].Fixed)
+}
+
+func TestFixVersion(t *testing.T) {
+	db, err := LoadDatabase(writeDir(t))
+	require.NoError(t, err)
+
+	used := usedPackages("example.com/foo/headers")
+	require.Equal(t, "v1.2.0", db.FixVersion("example.com/foo", db.Check("example.com/foo", "v1.1.0", used), used))
+
+	// v1.2.0 fixes the first vulnerability, but has the second, which is fixed in v1.4.0
+	used = usedPackages("example.com/foo/headers", "example.com/foo/cookies")
+	require.Equal(t, "v1.4.0", db.FixVersion("example.com/foo", db.Check("example.com/foo", "v1.1.0", used), used))
+
+	require.Equal(t, "", db.FixVersion("example.com/bar", db.Check("example.com/bar", "v1.0.0", used), used))
+}
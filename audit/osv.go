@@ -0,0 +1,243 @@
+// Package audit checks the third party modules against a local database of Go vulnerabilities in the OSV format, such as
+// a copy of https://vuln.go.dev, so it works without access to the network
+package audit
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Entry is a vulnerability in the OSV format. Only the fields we need are read.
+type Entry struct {
+	ID        string     `json:"id"`
+	Aliases   []string   `json:"aliases,omitempty"`
+	Summary   string     `json:"summary,omitempty"`
+	Details   string     `json:"details,omitempty"`
+	Withdrawn string     `json:"withdrawn,omitempty"`
+	Affected  []Affected `json:"affected"`
+}
+
+// Affected is a module affected by a vulnerability, and the versions of it that are affected
+type Affected struct {
+	Package           Package           `json:"package"`
+	Ranges            []Range           `json:"ranges,omitempty"`
+	EcosystemSpecific EcosystemSpecific `json:"ecosystem_specific,omitempty"`
+}
+
+// Package identifies a module in OSV
+type Package struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+}
+
+// Range is a range of affected versions, as a list of events where the vulnerability was introduced or fixed
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event is where a vulnerability was introduced or fixed. Versions are semver without the v prefix, and an introduced
+// version of 0 means all versions before the next fix.
+type Event struct {
+	Introduced string `json:"introduced,omitempty"`
+	Fixed      string `json:"fixed,omitempty"`
+}
+
+// EcosystemSpecific is the Go specific information about a vulnerability
+type EcosystemSpecific struct {
+	// Imports are the packages in the module that are vulnerable. If there are none, the whole module is.
+	Imports []AffectedPackage `json:"imports,omitempty"`
+}
+
+// AffectedPackage is a package in a module that's vulnerable
+type AffectedPackage struct {
+	Path    string   `json:"path"`
+	Symbols []string `json:"symbols,omitempty"`
+}
+
+// Database is the vulnerabilities, indexed by the module they affect
+type Database struct {
+	modules map[string][]*Entry
+}
+
+// LoadDatabase loads the OSV entries from a directory, or a zip file, such as https://vuln.go.dev/vulndb.zip. Every
+// .json file is read, apart from those in index directories. Withdrawn entries are skipped.
+func LoadDatabase(path string) (*Database, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &Database{modules: map[string][]*Entry{}}
+	if info.IsDir() {
+		err = db.loadDir(path)
+	} else {
+		err = db.loadZip(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entries := range db.modules {
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].ID < entries[j].ID
+		})
+	}
+	return db, nil
+}
+
+func (db *Database) loadDir(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == "index" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".json" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return db.add(path, data)
+	})
+}
+
+func (db *Database) loadZip(path string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() || filepath.Ext(f.Name) != ".json" || strings.HasPrefix(f.Name, "index/") || strings.Contains(f.Name, "/index/") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := db.add(f.Name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add parses an OSV entry and adds it to the database
+func (db *Database) add(path string, data []byte) error {
+	entry := new(Entry)
+	if err := json.Unmarshal(data, entry); err != nil {
+		return fmt.Errorf("failed to parse the OSV entry in %s: %v", path, err)
+	}
+	if entry.ID == "" || entry.Withdrawn != "" {
+		return nil
+	}
+
+	seen := map[string]struct{}{}
+	for _, a := range entry.Affected {
+		if a.Package.Ecosystem != "Go" {
+			continue
+		}
+		if _, ok := seen[a.Package.Name]; ok {
+			continue
+		}
+		seen[a.Package.Name] = struct{}{}
+		db.modules[a.Package.Name] = append(db.modules[a.Package.Name], entry)
+	}
+	return nil
+}
+
+// Entries returns the vulnerabilities that affect any version of the module, sorted by ID
+func (db *Database) Entries(module string) []*Entry {
+	return db.modules[module]
+}
+
+// affects returns true if the version of the module is in one of the ranges of affected versions
+func (a *Affected) affects(version string) bool {
+	for _, r := range a.Ranges {
+		if r.Type != "SEMVER" {
+			continue
+		}
+		affected := false
+		for _, e := range sortedEvents(r.Events) {
+			if e.Introduced == "0" || (e.Introduced != "" && semver.Compare(version, canonical(e.Introduced)) >= 0) {
+				affected = true
+			}
+			if e.Fixed != "" && semver.Compare(version, canonical(e.Fixed)) >= 0 {
+				affected = false
+			}
+		}
+		if affected {
+			return true
+		}
+	}
+	return false
+}
+
+// fixedAfter returns the earliest version after this one that fixes the vulnerability, or an empty string if there
+// isn't a fix yet
+func (a *Affected) fixedAfter(version string) string {
+	var ret string
+	for _, r := range a.Ranges {
+		if r.Type != "SEMVER" {
+			continue
+		}
+		for _, e := range r.Events {
+			if e.Fixed == "" {
+				continue
+			}
+			fixed := canonical(e.Fixed)
+			if semver.Compare(fixed, version) > 0 && (ret == "" || semver.Compare(fixed, ret) < 0) {
+				ret = fixed
+			}
+		}
+	}
+	return ret
+}
+
+// sortedEvents sorts the events by their version, so the range can be evaluated in order
+func sortedEvents(events []Event) []Event {
+	ret := append([]Event{}, events...)
+	version := func(e Event) string {
+		if e.Introduced != "" {
+			return canonical(e.Introduced)
+		}
+		return canonical(e.Fixed)
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return semver.Compare(version(ret[i]), version(ret[j])) < 0
+	})
+	return ret
+}
+
+// canonical converts an OSV version to a Go module version e.g. 1.2.3 -> v1.2.3. The introduced version 0 comes before
+// every version, including pseudo-versions, so it's converted to an empty string, which semver sorts first.
+func canonical(version string) string {
+	if version == "0" {
+		return ""
+	}
+	if !strings.HasPrefix(version, "v") {
+		return "v" + version
+	}
+	return version
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tatskaari/go-deps/audit"
+	"github.com/tatskaari/go-deps/resolve/model"
+	"github.com/tatskaari/go-deps/rules"
+	"github.com/tatskaari/go-deps/scan"
+)
+
+type auditCommand struct {
+	DB  string `long:"db" required:"true" description:"The directory or zip file containing the vulnerability database in OSV format e.g. a copy of https://vuln.go.dev/vulndb.zip."`
+	Fix bool   `long:"fix" description:"Upgrade the vulnerable modules to the earliest version that fixes them. Use -w to write the rules."`
+}
+
+// Execute checks the versions of the third party modules against the vulnerability database. Only the modules passed in
+// are checked, if there are any.
+func (cmd *auditCommand) Execute(args []string) error {
+	db, err := audit.LoadDatabase(cmd.DB)
+	if err != nil {
+		return err
+	}
+
+	moduleGraph, structured, err := parseRules()
+	if err != nil {
+		return err
+	}
+
+	imports, err := scan.Imports(".", opts.ThirdPartyFolder)
+	if err != nil {
+		return err
+	}
+	imported := map[string]struct{}{}
+	for _, i := range imports {
+		imported[i] = struct{}{}
+	}
+
+	only := map[string]struct{}{}
+	for _, arg := range args {
+		only[arg] = struct{}{}
+	}
+
+	modulePath := scan.ModulePath(".")
+	var upgrades, unfixed []string
+	vulnerable := 0
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if _, ok := only[m.Name]; len(only) > 0 && !ok {
+			continue
+		}
+		if scan.IsFirstParty(m.Name, modulePath) || m.Version == "" {
+			continue
+		}
+		// Replaced modules are checked against the module that replaces them, unless it's a local directory
+		path := m.Name
+		if m.ReplacedBy != "" {
+			if strings.HasPrefix(m.ReplacedBy, ".") || strings.HasPrefix(m.ReplacedBy, "/") {
+				continue
+			}
+			path = m.ReplacedBy
+		}
+
+		used := usedBy(moduleGraph, m, imported)
+		findings := db.Check(path, m.Version, used)
+		if len(findings) == 0 {
+			continue
+		}
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		vulnerable++
+
+		fix := db.FixVersion(path, findings, used)
+		switch {
+		case fix == "":
+			unfixed = append(unfixed, m.Name)
+			fmt.Fprintf(os.Stderr, "%s has vulnerabilities that aren't fixed yet\n", m.Name)
+		case m.ReplacedBy != "":
+			unfixed = append(unfixed, m.Name)
+			fmt.Fprintf(os.Stderr, "Upgrade %s to %s@%s in its replace directive to fix it\n", m.Name, m.ReplacedBy, fix)
+		default:
+			// Resolve everything the rules install at the fixed version, as the module's root might not be a package
+			upgrades = append(upgrades, pinnedInstalls(m, fix)...)
+			fmt.Fprintf(os.Stderr, "Upgrade %s to %s to fix it\n", m.Name, fix)
+		}
+	}
+
+	if vulnerable == 0 {
+		fmt.Fprintln(os.Stderr, "No known vulnerabilities found")
+		return nil
+	}
+	if !cmd.Fix {
+		return fmt.Errorf("found vulnerabilities in %d module(s). Run go-deps audit --fix to upgrade the ones that have a fix", vulnerable)
+	}
+	if len(upgrades) > 0 {
+		mergeDuplicates(moduleGraph, structured)
+		if err := update(moduleGraph, structured, upgrades); err != nil {
+			return err
+		}
+	}
+	if len(unfixed) > 0 {
+		return fmt.Errorf("couldn't fix the vulnerabilities in %s", strings.Join(unfixed, ", "))
+	}
+	return nil
+}
+
+// usedBy returns a function that checks whether we use a package in the module. We use a package if one of the
+// module's rules installs it, or our code imports it.
+func usedBy(moduleGraph *rules.BuildGraph, m *model.Module, imported map[string]struct{}) func(pkg string) bool {
+	return func(pkg string) bool {
+		if _, ok := imported[pkg]; ok {
+			return true
+		}
+		// The vulnerability database uses the path of the module that replaces this one, but the packages are installed
+		// under the original module's path
+		if m.ReplacedBy != "" {
+			pkg = m.Name + strings.TrimPrefix(pkg, m.ReplacedBy)
+		}
+		part := moduleGraph.Modules.Provider(pkg)
+		return part != nil && part.Module == m
+	}
+}
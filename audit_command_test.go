@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsedBy(t *testing.T) {
+	moduleGraph := readTestRepo(t, map[string]string{"third_party/go/BUILD": testRules})
+	imported := map[string]struct{}{"example.com/baz/y": {}}
+
+	baz := moduleGraph.Modules.GetModule(modKey("example.com/baz"))
+	used := usedBy(moduleGraph, baz, imported)
+	require.True(t, used("example.com/baz/x"), "baz installs x")
+	require.True(t, used("example.com/baz/y"), "we import y")
+	require.False(t, used("example.com/baz/z"))
+
+	// The vulnerability database uses the path of the module that replaces it
+	baz.ReplacedBy = "example.com/fork/baz"
+	used = usedBy(moduleGraph, baz, imported)
+	require.True(t, used("example.com/fork/baz/x"))
+	require.False(t, used("example.com/fork/baz/z"))
+}
+
+func TestUpgradeResolvesTheInstalledPackages(t *testing.T) {
+	moduleGraph := readTestRepo(t, map[string]string{"third_party/go/BUILD": testRules})
+
+	// Nothing imports baz's root package, so the upgrade has to resolve the package it installs
+	require.Equal(t, []string{"example.com/baz/x@v2.0.1"}, pinnedInstalls(moduleGraph.Modules.GetModule(modKey("example.com/baz")), "v2.0.1"))
+	require.Equal(t, []string{"example.com/foo/...@v1.0.1"}, pinnedInstalls(moduleGraph.Modules.GetModule(modKey("example.com/foo")), "v1.0.1"))
+}
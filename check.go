@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tatskaari/go-deps/resolve"
+	"github.com/tatskaari/go-deps/resolve/model"
+	"github.com/tatskaari/go-deps/rules"
+	"github.com/tatskaari/go-deps/scan"
+)
+
+// check runs the whole update without writing anything. Every package the rules install is resolved again at the
+// version in the rules, along with any packages passed in, and every rule is updated. It fails, printing a diff, if any
+// of the rules would change, or if the rules have structural problems.
+func check(packages []string) error {
+	moduleGraph, structured, err := parseRules()
+	if err != nil {
+		return err
+	}
+
+	problems := moduleGraph.Problems(opts.ThirdPartyFolder)
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+	if opts.Backend != "bazel" {
+		moduleGraph.MergeDuplicates(structured, opts.ThirdPartyFolder)
+	}
+
+	getPaths := append(installedPaths(moduleGraph), packages...)
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		for _, part := range m.Parts {
+			part.Modified = true
+		}
+	}
+
+	before := moduleGraph.Modules.Snapshot()
+	if len(getPaths) > 0 {
+		if err := resolveRules(moduleGraph, structured, getPaths); err != nil {
+			return err
+		}
+	} else if err := moduleGraph.Update(structured, opts.ThirdPartyFolder); err != nil {
+		return err
+	}
+	changed, err := moduleGraph.Diff(os.Stdout)
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := resolve.WriteSummary(os.Stderr, before, moduleGraph.Modules.Snapshot()); err != nil {
+			return err
+		}
+	}
+
+	files, err := moduleGraph.UpdateFirstPartyDeps(".", opts.ThirdPartyFolder, nil)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Fprintf(os.Stderr, "%s has %d renamed third party label(s) to update\n", f.Path, f.Labels)
+	}
+
+	var failures []string
+	if len(problems) > 0 {
+		failures = append(failures, fmt.Sprintf("found %d problem(s) with the third party rules", len(problems)))
+	}
+	if changed || len(files) > 0 {
+		failures = append(failures, "the third party rules are out of date. Apply the diff above, or run go-deps -w, to update them")
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	fmt.Fprintln(os.Stderr, "The third party rules are up to date")
+	return nil
+}
+
+// installedPaths returns the packages and wildcards installed by the third party rules, pinned to the version of their
+// module in the rules. Modules that are replaced are resolved at whatever version they're replaced with.
+func installedPaths(moduleGraph *rules.BuildGraph) []string {
+	modulePath := scan.ModulePath(".")
+
+	var ret []string
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if scan.IsFirstParty(m.Name, modulePath) {
+			continue
+		}
+		version := m.Version
+		if m.ReplacedBy != "" {
+			version = ""
+		}
+		ret = append(ret, pinnedInstalls(m, version)...)
+	}
+	return ret
+}
+
+// pinnedInstalls returns the packages and wildcards installed by the module's rules, pinned to the version if it's set
+func pinnedInstalls(m *model.Module, version string) []string {
+	pin := func(path string) string {
+		if version == "" {
+			return path
+		}
+		return path + "@" + version
+	}
+
+	var ret []string
+	for _, part := range m.Parts {
+		for _, pkg := range part.SortedPackages() {
+			ret = append(ret, pin(pkg.ID))
+		}
+		for _, i := range part.InstallWildCards {
+			ret = append(ret, pin(filepath.Join(m.Name, i)+"/..."))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstalledPaths(t *testing.T) {
+	moduleGraph := readTestRepo(t, map[string]string{
+		"go.mod": "module example.com/repo\n",
+		"third_party/go/BUILD": testRules + `
+go_module(
+    name = "qux",
+    module = "example.com/qux",
+    version = "v0.1.0",
+)
+
+go_module(
+    name = "repo",
+    install = ["lib"],
+    module = "example.com/repo",
+)
+`,
+	})
+	moduleGraph.Modules.GetModule(modKey("example.com/qux")).ReplacedBy = "example.com/fork/qux"
+
+	// First party modules are skipped, and replaced modules aren't pinned
+	require.Equal(t, []string{
+		"example.com/bar@v1.1.0",
+		"example.com/baz/x@v2.0.0",
+		"example.com/foo/...@v1.0.0",
+		"example.com/qux",
+	}, installedPaths(moduleGraph))
+}
@@ -0,0 +1,122 @@
+// Package config reads go-deps' config from the .godepsconfig file, and the parts of the .plzconfig that go-deps uses.
+// Both are in the same ini style format as the .plzconfig e.g.
+//
+//	[licences]
+//	reject = AGPL-3.0
+//
+//	[licenceexception "github.com/example/module"]
+//	justification = Approved by legal
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileName is the name of go-deps' config file, which lives in the root of the repo
+const FileName = ".godepsconfig"
+
+// Config is the values set in one or more config files, keyed by section and then by key. Section names and keys are
+// case insensitive, so are lower case, but the names of subsections e.g. [plugin "go"] are kept as they are. Keys can
+// be repeated to set more than one value.
+type Config map[string]map[string][]string
+
+// Read reads the config files in order. Files that don't exist are skipped, and values in later files are added to the
+// values from earlier ones.
+func Read(paths ...string) (Config, error) {
+	c := Config{}
+	for _, path := range paths {
+		if err := c.readFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// ReadRepo reads the .plzconfig and then the .godepsconfig in the root of the repo
+func ReadRepo(root string) (Config, error) {
+	return Read(filepath.Join(root, ".plzconfig"), filepath.Join(root, FileName))
+}
+
+func (c Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, ";") || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+			section = sectionName(text[1 : len(text)-1])
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%s:%d: expected key = value, got %q", path, line, text)
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		if c[section] == nil {
+			c[section] = map[string][]string{}
+		}
+		c[section][key] = append(c[section][key], strings.TrimSpace(parts[1]))
+	}
+	return scanner.Err()
+}
+
+// sectionName normalises the name of a section e.g. `Plugin  "go"` -> `plugin "go"`
+func sectionName(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	fields[0] = strings.ToLower(fields[0])
+	return strings.Join(fields, " ")
+}
+
+// Get returns the values of the key in the section
+func (c Config) Get(section, key string) []string {
+	return c[sectionName(section)][strings.ToLower(key)]
+}
+
+// GetString returns the last value of the key in the section, or an empty string if it's not set
+func (c Config) GetString(section, key string) string {
+	values := c.Get(section, key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// GetBool returns true if the key in the section is set to true, yes or 1
+func (c Config) GetBool(section, key string) bool {
+	switch strings.ToLower(c.GetString(section, key)) {
+	case "true", "yes", "1":
+		return true
+	}
+	return false
+}
+
+// Subsections returns the names of the subsections of a section, sorted e.g. the modules in [licenceexception "..."]
+func (c Config) Subsections(section string) []string {
+	prefix := strings.ToLower(section) + " "
+	var ret []string
+	for name := range c {
+		if strings.HasPrefix(name, prefix) {
+			ret = append(ret, strings.Trim(strings.TrimPrefix(name, prefix), `"`))
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRead(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".plzconfig"), []byte(`[Licences]
+Accept = MIT
+accept = Apache-2.0
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte(`; Legal have asked us not to use these
+[licences]
+reject = AGPL-3.0
+rejectunknown = true
+
+[LicenceException "github.com/Example/module"]
+justification = Approved by legal
+`), 0644))
+
+	c, err := ReadRepo(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"MIT", "Apache-2.0"}, c.Get("licences", "accept"))
+	require.Equal(t, []string{"AGPL-3.0"}, c.Get("licences", "reject"))
+	require.True(t, c.GetBool("licences", "rejectunknown"))
+	require.Equal(t, []string{"github.com/Example/module"}, c.Subsections("licenceexception"))
+	require.Equal(t, "Approved by legal", c.GetString(`licenceexception "github.com/Example/module"`, "justification"))
+
+	c, err = ReadRepo(t.TempDir())
+	require.NoError(t, err)
+	require.Empty(t, c)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tatskaari/go-deps/resolve/knownimports"
+	"github.com/tatskaari/go-deps/scan"
+)
+
+type fixCommand struct{}
+
+func (cmd *fixCommand) Execute(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	if err := requirePlease("fix"); err != nil {
+		return err
+	}
+
+	moduleGraph, structured, err := readRules()
+	if err != nil {
+		return err
+	}
+
+	imports, err := scan.Imports(".", opts.ThirdPartyFolder)
+	if err != nil {
+		return err
+	}
+
+	modulePath := scan.ModulePath(".")
+	var missing []string
+	for _, i := range imports {
+		if knownimports.IsInGoRoot(i) || scan.IsFirstParty(i, modulePath) || moduleGraph.Modules.IsProvided(i) {
+			continue
+		}
+		missing = append(missing, i)
+	}
+
+	if len(missing) == 0 {
+		fmt.Fprintln(os.Stderr, "All imports are provided by a go_module() already")
+		return nil
+	}
+
+	fmt.Fprintf(os.Stderr, "Adding %d missing package(s):\n", len(missing))
+	for _, i := range missing {
+		fmt.Fprintf(os.Stderr, "  %s\n", i)
+	}
+	return update(moduleGraph, structured, missing)
+}
@@ -0,0 +1,311 @@
+// Package graph exports the module graph read from the third party BUILD files so it can be visualised and diffed.
+//
+// The graph is made up of three kinds of node:
+//   - modules, with the ID "module:<module path>"
+//   - module parts i.e. go_module() rules, with the ID "part:<build label>"
+//   - packages, with the ID "package:<import path>"
+//
+// Deps that don't refer to a go_module() rule in the graph are included as nodes with the ID "label:<build label>" so
+// that they're not silently dropped.
+//
+// The edges between them have the following kinds:
+//   - "part" from a module to each of its parts
+//   - "package" from a part to each of the packages it installs
+//   - "dep" and "exported_dep" from a part to the rules in its deps and exported_deps respectively
+//   - "module_dep" from a module to each module its parts depend on
+//   - "import" from a package to each package it imports, where these are known
+//
+// When serialised as JSON, the graph has the following schema:
+//
+//	{
+//	  "nodes": [{
+//	    "id": string,
+//	    "kind": "module" | "part" | "package" | "label",
+//	    "name": string,       // The module path, build label or import path
+//	    "module": string,     // The module path this node belongs to, if any
+//	    "version": string,    // Modules only
+//	    "replace": string,    // Modules only, set if the module is replaced by another
+//	    "licence": string,    // Modules only
+//	    "install": [string],  // Parts only, any wildcard installs e.g. "foo/..."
+//	  }],
+//	  "edges": [{"from": string, "to": string, "kind": string}]
+//	}
+//
+// Nodes and edges are sorted so the output is stable across runs.
+package graph
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/tatskaari/go-deps/resolve/model"
+	"github.com/tatskaari/go-deps/rules"
+)
+
+const (
+	ModuleNode  = "module"
+	PartNode    = "part"
+	PackageNode = "package"
+	LabelNode   = "label"
+
+	PartEdge        = "part"
+	PackageEdge     = "package"
+	DepEdge         = "dep"
+	ExportedDepEdge = "exported_dep"
+	ModuleDepEdge   = "module_dep"
+	ImportEdge      = "import"
+)
+
+// Node is a module, module part, or package in the graph
+type Node struct {
+	ID      string   `json:"id"`
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Module  string   `json:"module,omitempty"`
+	Version string   `json:"version,omitempty"`
+	Replace string   `json:"replace,omitempty"`
+	Licence string   `json:"licence,omitempty"`
+	Install []string `json:"install,omitempty"`
+}
+
+// Edge is a directed edge between two nodes in the graph
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// Graph is the module, part and package graph
+type Graph struct {
+	Nodes []*Node `json:"nodes"`
+	Edges []*Edge `json:"edges"`
+
+	nodes map[string]*Node
+	edges map[Edge]struct{}
+}
+
+func moduleID(path string) string {
+	return ModuleNode + ":" + path
+}
+
+func partID(label string) string {
+	return PartNode + ":" + label
+}
+
+func packageID(path string) string {
+	return PackageNode + ":" + path
+}
+
+func newGraph() *Graph {
+	return &Graph{
+		nodes: map[string]*Node{},
+		edges: map[Edge]struct{}{},
+	}
+}
+
+func (g *Graph) addNode(node *Node) *Node {
+	if n, ok := g.nodes[node.ID]; ok {
+		return n
+	}
+	g.nodes[node.ID] = node
+	g.Nodes = append(g.Nodes, node)
+	return node
+}
+
+func (g *Graph) addEdge(from, to, kind string) {
+	e := Edge{From: from, To: to, Kind: kind}
+	if _, ok := g.edges[e]; ok {
+		return
+	}
+	g.edges[e] = struct{}{}
+	g.Edges = append(g.Edges, &e)
+}
+
+// Node returns the node with the given ID, or nil if it's not in the graph
+func (g *Graph) Node(id string) *Node {
+	return g.nodes[id]
+}
+
+func (g *Graph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		if g.Edges[i].To != g.Edges[j].To {
+			return g.Edges[i].To < g.Edges[j].To
+		}
+		return g.Edges[i].Kind < g.Edges[j].Kind
+	})
+}
+
+// Build builds the graph from the rules that have been read into the build graph
+func Build(buildGraph *rules.BuildGraph) *Graph {
+	g := newGraph()
+	parts := buildGraph.PartsByLabel()
+
+	addPart := func(label string, part *model.ModulePart) {
+		node := g.addNode(&Node{
+			ID:     partID(label),
+			Kind:   PartNode,
+			Name:   label,
+			Module: part.Module.Name,
+		})
+		for _, i := range part.InstallWildCards {
+			node.Install = append(node.Install, strings.TrimPrefix(i+"/...", "/"))
+		}
+		sort.Strings(node.Install)
+	}
+
+	for _, m := range buildGraph.Modules.Mods {
+		g.addNode(&Node{
+			ID:      moduleID(m.Name),
+			Kind:    ModuleNode,
+			Name:    m.Name,
+			Module:  m.Name,
+			Version: m.Version,
+			Replace: m.ReplacedBy,
+			Licence: m.Licence,
+		})
+
+		for _, part := range m.Parts {
+			label := buildGraph.PartLabel(part)
+			if label == "" {
+				continue
+			}
+			addPart(label, part)
+			g.addEdge(moduleID(m.Name), partID(label), PartEdge)
+
+			for pkg := range part.Packages {
+				g.addNode(&Node{
+					ID:     packageID(pkg.ID),
+					Kind:   PackageNode,
+					Name:   pkg.ID,
+					Module: m.Name,
+				})
+				g.addEdge(partID(label), packageID(pkg.ID), PackageEdge)
+				for _, i := range pkg.Imports {
+					g.addEdge(packageID(pkg.ID), packageID(i.ID), ImportEdge)
+				}
+			}
+
+			deps, exportedDeps := buildGraph.PartDeps(part)
+			addDeps := func(labels []string, kind string) {
+				for _, dep := range labels {
+					depPart, ok := parts[dep]
+					if !ok {
+						g.addNode(&Node{ID: LabelNode + ":" + dep, Kind: LabelNode, Name: dep})
+						g.addEdge(partID(label), LabelNode+":"+dep, kind)
+						continue
+					}
+					g.addEdge(partID(label), partID(dep), kind)
+					if depPart.Module != m {
+						g.addEdge(moduleID(m.Name), moduleID(depPart.Module.Name), ModuleDepEdge)
+					}
+				}
+			}
+			addDeps(deps, DepEdge)
+			addDeps(exportedDeps, ExportedDepEdge)
+		}
+	}
+
+	// Drop any import edges to packages we don't know about. These are most likely in the standard library.
+	edges := g.Edges[:0]
+	for _, e := range g.Edges {
+		if e.Kind == ImportEdge && g.nodes[e.To] == nil {
+			delete(g.edges, *e)
+			continue
+		}
+		edges = append(edges, e)
+	}
+	g.Edges = edges
+
+	g.sort()
+	return g
+}
+
+// Reachable returns the subgraph reachable from the given modules by following the dependencies of their parts
+func (g *Graph) Reachable(modules ...string) *Graph {
+	return g.subgraph(modules, false)
+}
+
+// ReverseDeps returns the subgraph of modules that transitively depend on the given modules
+func (g *Graph) ReverseDeps(modules ...string) *Graph {
+	return g.subgraph(modules, true)
+}
+
+// subgraph finds the modules reachable from the given modules, and returns the graph containing only the nodes for
+// those modules.
+func (g *Graph) subgraph(modules []string, reverse bool) *Graph {
+	next := map[string][]string{}
+	for _, e := range g.Edges {
+		if e.Kind != ModuleDepEdge {
+			continue
+		}
+		if reverse {
+			next[e.To] = append(next[e.To], e.From)
+		} else {
+			next[e.From] = append(next[e.From], e.To)
+		}
+	}
+
+	keep := map[string]struct{}{}
+	var visit func(id string)
+	visit = func(id string) {
+		if _, ok := keep[id]; ok {
+			return
+		}
+		keep[id] = struct{}{}
+		for _, n := range next[id] {
+			visit(n)
+		}
+	}
+	for _, m := range modules {
+		if g.nodes[moduleID(m)] != nil {
+			visit(moduleID(m))
+		}
+	}
+
+	ret := newGraph()
+	for _, n := range g.Nodes {
+		if n.Module == "" {
+			continue
+		}
+		if _, ok := keep[moduleID(n.Module)]; ok {
+			ret.addNode(n)
+		}
+	}
+	for _, e := range g.Edges {
+		if ret.nodes[e.From] == nil {
+			continue
+		}
+		// Keep any deps on labels outside the graph that the kept parts have
+		if to := g.nodes[e.To]; to.Kind == LabelNode {
+			ret.addNode(to)
+		}
+		if ret.nodes[e.To] != nil {
+			ret.addEdge(e.From, e.To, e.Kind)
+		}
+	}
+	ret.sort()
+	return ret
+}
+
+// WithoutPackages returns a copy of the graph without any of the package nodes
+func (g *Graph) WithoutPackages() *Graph {
+	ret := newGraph()
+	for _, n := range g.Nodes {
+		if n.Kind != PackageNode {
+			ret.addNode(n)
+		}
+	}
+	for _, e := range g.Edges {
+		if ret.nodes[e.From] != nil && ret.nodes[e.To] != nil {
+			ret.addEdge(e.From, e.To, e.Kind)
+		}
+	}
+	ret.sort()
+	return ret
+}
@@ -0,0 +1,96 @@
+package graph
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/rules"
+)
+
+const buildFile = `
+go_module(
+    name = "a",
+    module = "example.com/a",
+    version = "v1.0.0",
+    deps = [":b"],
+)
+
+go_module(
+    name = "b_1",
+    module = "example.com/b",
+    version = "v1.0.0",
+    install = ["foo"],
+)
+
+go_module(
+    name = "b",
+    module = "example.com/b",
+    version = "v1.0.0",
+    install = ["bar/..."],
+    deps = [":c", "//other:rule"],
+    exported_deps = [":b_1"],
+)
+
+go_module(
+    name = "c",
+    module = "example.com/c",
+    version = "v1.0.0",
+)
+`
+
+func readGraph(t *testing.T) *Graph {
+	path := filepath.Join(t.TempDir(), "BUILD")
+	require.NoError(t, os.WriteFile(path, []byte(buildFile), 0644))
+
+	buildGraph := rules.NewGraph("BUILD")
+	require.NoError(t, buildGraph.ReadRules(path))
+
+	return Build(buildGraph)
+}
+
+func TestBuild(t *testing.T) {
+	g := readGraph(t)
+
+	b := g.Node(moduleID("example.com/b"))
+	require.NotNil(t, b)
+	require.Equal(t, "v1.0.0", b.Version)
+
+	var partEdges, depEdges, exportedDepEdges, moduleDepEdges int
+	for _, e := range g.Edges {
+		switch e.Kind {
+		case PartEdge:
+			partEdges++
+		case DepEdge:
+			depEdges++
+		case ExportedDepEdge:
+			exportedDepEdges++
+		case ModuleDepEdge:
+			moduleDepEdges++
+		}
+	}
+	require.Equal(t, 4, partEdges)
+	require.Equal(t, 3, depEdges)
+	require.Equal(t, 1, exportedDepEdges)
+	// a -> b and b -> c
+	require.Equal(t, 2, moduleDepEdges)
+
+	require.NotNil(t, g.Node(LabelNode+"://other:rule"))
+}
+
+func TestSubgraphs(t *testing.T) {
+	g := readGraph(t)
+
+	reachable := g.Reachable("example.com/b")
+	require.Nil(t, reachable.Node(moduleID("example.com/a")))
+	require.NotNil(t, reachable.Node(moduleID("example.com/b")))
+	require.NotNil(t, reachable.Node(moduleID("example.com/c")))
+	require.NotNil(t, reachable.Node(LabelNode+"://other:rule"))
+
+	rdeps := g.ReverseDeps("example.com/b")
+	require.NotNil(t, rdeps.Node(moduleID("example.com/a")))
+	require.NotNil(t, rdeps.Node(moduleID("example.com/b")))
+	require.Nil(t, rdeps.Node(moduleID("example.com/c")))
+}
@@ -0,0 +1,91 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteJSON writes the graph out as JSON following the schema documented on the package
+func WriteJSON(w io.Writer, g *Graph) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+var edgeStyles = map[string]string{
+	PackageEdge:     "style=dotted",
+	ExportedDepEdge: "style=dashed",
+	ImportEdge:      "color=grey",
+	ModuleDepEdge:   "color=blue",
+}
+
+// WriteDOT writes the graph out in the Graphviz DOT format. Each module is drawn as a cluster containing its parts
+// and packages.
+func WriteDOT(w io.Writer, g *Graph) error {
+	p := &dotPrinter{w: w}
+
+	p.printf("digraph modules {\n")
+	p.printf("  rankdir=LR;\n")
+	p.printf("  node [shape=box];\n")
+
+	children := map[string][]*Node{}
+	for _, n := range g.Nodes {
+		if n.Kind == PartNode || n.Kind == PackageNode {
+			children[n.Module] = append(children[n.Module], n)
+		}
+	}
+
+	cluster := 0
+	for _, n := range g.Nodes {
+		switch n.Kind {
+		case ModuleNode:
+			p.printf("  subgraph cluster_%d {\n", cluster)
+			cluster++
+
+			label := n.Name
+			if n.Version != "" {
+				label += "@" + n.Version
+			}
+			if n.Replace != "" {
+				label += " => " + n.Replace
+			}
+			p.printf("    label=%s;\n", strconv.Quote(label))
+			p.printf("    %s [shape=folder, label=%s];\n", strconv.Quote(n.ID), strconv.Quote(n.Name))
+			for _, c := range children[n.Module] {
+				if c.Kind == PartNode {
+					p.printf("    %s [label=%s];\n", strconv.Quote(c.ID), strconv.Quote(c.Name))
+				} else {
+					p.printf("    %s [shape=ellipse, label=%s];\n", strconv.Quote(c.ID), strconv.Quote(c.Name))
+				}
+			}
+			p.printf("  }\n")
+		case LabelNode:
+			p.printf("  %s [style=dashed, label=%s];\n", strconv.Quote(n.ID), strconv.Quote(n.Name))
+		}
+	}
+
+	for _, e := range g.Edges {
+		attrs := fmt.Sprintf("label=%s", strconv.Quote(e.Kind))
+		if style, ok := edgeStyles[e.Kind]; ok {
+			attrs += ", " + style
+		}
+		p.printf("  %s -> %s [%s];\n", strconv.Quote(e.From), strconv.Quote(e.To), attrs)
+	}
+	p.printf("}\n")
+	return p.err
+}
+
+// dotPrinter remembers the first error encountered while writing so we don't have to check every write
+type dotPrinter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *dotPrinter) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
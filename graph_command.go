@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tatskaari/go-deps/graph"
+)
+
+type graphCommand struct {
+	Format   string   `long:"format" short:"f" default:"dot" choice:"dot" choice:"json" description:"The format to print the graph in."`
+	From     []string `long:"from" description:"Only include modules reachable from this module. Can be repeated."`
+	RevDeps  []string `long:"rdeps" description:"Only include modules that transitively depend on this module. Can be repeated."`
+	Packages bool     `long:"packages" description:"Include the packages each module part installs in the graph."`
+}
+
+func (cmd *graphCommand) Execute(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	moduleGraph, _, err := parseRules()
+	if err != nil {
+		return err
+	}
+
+	g := graph.Build(moduleGraph)
+	if len(cmd.From) > 0 {
+		g = g.Reachable(cmd.From...)
+	}
+	if len(cmd.RevDeps) > 0 {
+		g = g.ReverseDeps(cmd.RevDeps...)
+	}
+	if !cmd.Packages {
+		g = g.WithoutPackages()
+	}
+
+	if cmd.Format == "json" {
+		return graph.WriteJSON(os.Stdout, g)
+	}
+	return graph.WriteDOT(os.Stdout, g)
+}
@@ -0,0 +1,280 @@
+// Package journal writes files atomically, and keeps a backup of the files each run of go-deps changes, so the run can be
+// undone
+package journal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dir is where the journals are kept, relative to the root of the repo
+var Dir = filepath.Join("plz-out", "godeps", "journal")
+
+// keep is how many journals are kept. Older ones are deleted when a new one is started.
+const keep = 10
+
+const manifestName = "journal.json"
+
+// Entry is a file that was changed, and where its old contents are backed up
+type Entry struct {
+	Path string `json:"path"`
+	// Backup is the name of the file the old contents are in, relative to the journal, or empty if the file didn't exist
+	Backup string `json:"backup,omitempty"`
+	Mode   uint32 `json:"mode,omitempty"`
+	// Hash is the SHA-256 of what the run left in the file, or empty if the run removed it, so we can tell whether it's
+	// been changed since
+	Hash string `json:"hash,omitempty"`
+	// Dirs are the directories the run created for the file, deepest first, which are removed when it's undone
+	Dirs []string `json:"dirs,omitempty"`
+}
+
+// Journal is the backup of the files changed by one run of go-deps. It's written to a new directory under Dir the first
+// time a file is changed. Only the first change to each file is backed up, so undoing restores the files to how they
+// were before the run.
+type Journal struct {
+	root    string
+	dir     string
+	Entries []Entry
+	// saved is the index of the entry for each file
+	saved map[string]int
+}
+
+// New creates a journal in the directory, which is only written to once a file is changed
+func New(root string) *Journal {
+	return &Journal{root: root, saved: map[string]int{}}
+}
+
+// record backs up the old contents of the files changed by a transaction, once the changes have been made, along with
+// the hash of their new contents and any directories created for them. Files that have already been backed up by this
+// journal just have their hash updated. If any of the changes can't be recorded, the journal is left as it was. A nil
+// journal doesn't record anything.
+func (j *Journal) record(changes []*change) error {
+	if j == nil {
+		return nil
+	}
+	if j.dir == "" {
+		if err := j.create(); err != nil {
+			return fmt.Errorf("failed to create the journal: %v", err)
+		}
+	}
+
+	entries := append([]Entry{}, j.Entries...)
+	saved := make(map[string]int, len(j.saved))
+	for path, i := range j.saved {
+		saved[path] = i
+	}
+	for _, c := range changes {
+		if c.remove && !c.existed {
+			continue
+		}
+		hash := ""
+		if !c.remove {
+			hash = hashOf(c.data)
+		}
+		if i, ok := saved[c.path]; ok {
+			entries[i].Hash = hash
+			entries[i].Dirs = append(entries[i].Dirs, c.dirs...)
+			continue
+		}
+
+		entry := Entry{Path: c.path, Hash: hash, Dirs: c.dirs}
+		if c.existed {
+			entry.Backup = strconv.Itoa(len(entries))
+			entry.Mode = uint32(c.oldMode.Perm())
+			if err := os.WriteFile(filepath.Join(j.dir, entry.Backup), c.old, 0644); err != nil {
+				return fmt.Errorf("failed to back up %s: %v", c.path, err)
+			}
+		}
+		saved[c.path] = len(entries)
+		entries = append(entries, entry)
+	}
+	if err := writeManifest(j.dir, entries); err != nil {
+		return fmt.Errorf("failed to write the journal: %v", err)
+	}
+	j.Entries = entries
+	j.saved = saved
+	return nil
+}
+
+// writeManifest writes the list of entries to the journal directory
+func writeManifest(dir string, entries []Entry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFile(filepath.Join(dir, manifestName), data, 0644)
+}
+
+// create makes the directory for the journal, named after the current time so the journals sort in the order they were
+// made, and deletes the oldest journals
+func (j *Journal) create() error {
+	if err := os.MkdirAll(j.root, os.ModeDir|0775); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000000")
+	dir := filepath.Join(j.root, name)
+	for i := 1; ; i++ {
+		err := os.Mkdir(dir, os.ModeDir|0775)
+		if err == nil {
+			break
+		} else if !os.IsExist(err) {
+			return err
+		}
+		dir = filepath.Join(j.root, fmt.Sprintf("%s-%d", name, i))
+	}
+	j.dir = dir
+
+	names, err := journals(j.root)
+	if err != nil {
+		return err
+	}
+	for len(names) > keep {
+		if err := os.RemoveAll(filepath.Join(j.root, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// journals returns the names of the journals in the directory, oldest first
+func journals(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, e := range entries {
+		if e.IsDir() {
+			ret = append(ret, e.Name())
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// hashOf returns the hex encoded SHA-256 of the data
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ErrNothingToUndo is returned by Undo when there aren't any journals
+var ErrNothingToUndo = errors.New("there's nothing to undo")
+
+// ChangedError is returned by Undo when files have been changed since the run that's being undone, so restoring them
+// would lose those changes
+type ChangedError struct {
+	Paths []string
+}
+
+func (e *ChangedError) Error() string {
+	return fmt.Sprintf("%s changed after go-deps last wrote them, so undoing would overwrite those changes", strings.Join(e.Paths, ", "))
+}
+
+// Undo restores the files changed by the most recent run of go-deps to how they were before it, and then deletes its
+// journal, so the run before that can be undone next. Files the run created are deleted, along with any directories it
+// created for them. It returns the files that were
+// restored. If any of the files have been changed since the run, nothing is restored and a ChangedError is returned,
+// unless force is true.
+func Undo(root string, force bool) ([]Entry, error) {
+	names, err := journals(root)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, ErrNothingToUndo
+	}
+	return undo(filepath.Join(root, names[len(names)-1]), force)
+}
+
+// Undo restores the files changed so far by this journal, e.g. when a run fails part way through, and deletes it
+func (j *Journal) Undo() ([]Entry, error) {
+	if j.dir == "" {
+		return nil, nil
+	}
+	entries, err := undo(j.dir, false)
+	if err != nil {
+		return nil, err
+	}
+	j.dir = ""
+	j.Entries = nil
+	j.saved = map[string]int{}
+	return entries, nil
+}
+
+// undo restores the files backed up in the journal directory, and then deletes it
+func undo(dir string, force bool) ([]Entry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		// The run didn't get as far as changing anything
+		return nil, os.RemoveAll(dir)
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to read the journal in %s: %v", dir, err)
+	}
+	if !force {
+		if err := checkUnchanged(entries); err != nil {
+			return nil, err
+		}
+	}
+
+	tx := NewTransaction(nil)
+	for _, e := range entries {
+		if e.Backup == "" {
+			tx.Remove(e.Path)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Backup))
+		if err != nil {
+			return nil, err
+		}
+		tx.WriteFile(e.Path, data, os.FileMode(e.Mode))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	// A directory is recorded against the first file created in it, so going backwards means it's empty by the time we
+	// get to it
+	for i := len(entries) - 1; i >= 0; i-- {
+		removeEmptyDirs(entries[i].Dirs)
+	}
+	return entries, os.RemoveAll(dir)
+}
+
+// checkUnchanged returns a ChangedError if any of the files aren't how the run left them
+func checkUnchanged(entries []Entry) error {
+	var changed []string
+	for _, e := range entries {
+		data, err := os.ReadFile(e.Path)
+		if os.IsNotExist(err) {
+			if e.Hash != "" {
+				changed = append(changed, e.Path)
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		if hashOf(data) != e.Hash {
+			changed = append(changed, e.Path)
+		}
+	}
+	if len(changed) > 0 {
+		return &ChangedError{Paths: changed}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestUndo(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "plz-out/godeps/journal")
+	changed, created, removed := filepath.Join(dir, "BUILD"), filepath.Join(dir, "new/pkg/BUILD"), filepath.Join(dir, "old/BUILD")
+	require.NoError(t, os.MkdirAll(filepath.Dir(removed), 0775))
+	require.NoError(t, os.WriteFile(changed, []byte("before"), 0600))
+	require.NoError(t, os.WriteFile(removed, []byte("removed"), 0644))
+
+	j := New(root)
+	tx := NewTransaction(j)
+	tx.WriteFile(changed, []byte("after"), 0644)
+	tx.WriteFile(created, []byte("created"), 0644)
+	tx.Remove(removed)
+	require.NoError(t, tx.Commit())
+
+	// A later change to the same file in the same run doesn't replace the backup
+	tx = NewTransaction(j)
+	tx.WriteFile(changed, []byte("after again"), 0)
+	tx.WriteFile(filepath.Join(dir, "new/other/BUILD"), []byte("created"), 0644)
+	require.NoError(t, tx.Commit())
+
+	require.Equal(t, "after again", readFile(t, changed))
+	require.Equal(t, "created", readFile(t, created))
+	require.NoFileExists(t, removed)
+	info, err := os.Stat(changed)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm(), "the mode of existing files should be kept")
+
+	entries, err := Undo(root, false)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.Equal(t, "before", readFile(t, changed))
+	require.Equal(t, "removed", readFile(t, removed))
+	require.NoFileExists(t, created)
+	require.NoDirExists(t, filepath.Join(dir, "new"), "the directories the run created should be removed")
+	require.DirExists(t, filepath.Dir(removed))
+
+	_, err = Undo(root, false)
+	require.Equal(t, ErrNothingToUndo, err)
+}
+
+func TestUndoRefusesIfTheFilesHaveChanged(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "plz-out/godeps/journal")
+	changed, removed := filepath.Join(dir, "BUILD"), filepath.Join(dir, "old/BUILD")
+	require.NoError(t, os.MkdirAll(filepath.Dir(removed), 0775))
+	require.NoError(t, os.WriteFile(changed, []byte("before"), 0644))
+	require.NoError(t, os.WriteFile(removed, []byte("removed"), 0644))
+
+	tx := NewTransaction(New(root))
+	tx.WriteFile(changed, []byte("after"), 0644)
+	tx.Remove(removed)
+	require.NoError(t, tx.Commit())
+
+	// Edit both files by hand after the run
+	require.NoError(t, os.WriteFile(changed, []byte("edited"), 0644))
+	require.NoError(t, os.WriteFile(removed, []byte("recreated"), 0644))
+
+	_, err := Undo(root, false)
+	require.Equal(t, &ChangedError{Paths: []string{changed, removed}}, err)
+	require.Equal(t, "edited", readFile(t, changed), "nothing should be restored")
+
+	_, err = Undo(root, true)
+	require.NoError(t, err)
+	require.Equal(t, "before", readFile(t, changed))
+	require.Equal(t, "removed", readFile(t, removed))
+}
+
+func TestUndoJournal(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "plz-out/godeps/journal")
+	path := filepath.Join(dir, "BUILD")
+	require.NoError(t, os.WriteFile(path, []byte("before"), 0644))
+
+	j := New(root)
+	tx := NewTransaction(j)
+	tx.WriteFile(path, []byte("after"), 0644)
+	require.NoError(t, tx.Commit())
+
+	entries, err := j.Undo()
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "before", readFile(t, path))
+
+	_, err = Undo(root, false)
+	require.Equal(t, ErrNothingToUndo, err, "the journal should have been deleted")
+}
+
+func TestCommitChangesNothingIfAFileCantBeWritten(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "plz-out/godeps/journal")
+	ok, notADir := filepath.Join(dir, "BUILD"), filepath.Join(dir, "file")
+	require.NoError(t, os.WriteFile(ok, []byte("before"), 0644))
+	require.NoError(t, os.WriteFile(notADir, []byte(""), 0644))
+
+	tx := NewTransaction(New(root))
+	tx.WriteFile(ok, []byte("after"), 0644)
+	tx.WriteFile(filepath.Join(dir, "new/pkg/BUILD"), []byte("after"), 0644)
+	tx.WriteFile(filepath.Join(notADir, "BUILD"), []byte("after"), 0644)
+	require.Error(t, tx.Commit())
+
+	require.Equal(t, "before", readFile(t, ok))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.Equal(t, []string{"BUILD", "file"}, names, "the staged files and new directories should have been cleaned up, and nothing backed up")
+}
+
+func TestCommitChangesNothingIfItCantBeJournalled(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "journal")
+	path := filepath.Join(dir, "BUILD")
+	require.NoError(t, os.WriteFile(path, []byte("before"), 0644))
+	// The journal can't be created where there's a file
+	require.NoError(t, os.WriteFile(root, []byte(""), 0644))
+
+	j := New(root)
+	tx := NewTransaction(j)
+	tx.WriteFile(path, []byte("after"), 0644)
+	tx.WriteFile(filepath.Join(dir, "new/BUILD"), []byte("created"), 0644)
+	require.Error(t, tx.Commit())
+
+	require.Equal(t, "before", readFile(t, path))
+	require.NoDirExists(t, filepath.Join(dir, "new"))
+	require.Empty(t, j.Entries)
+}
@@ -0,0 +1,200 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type change struct {
+	path   string
+	data   []byte
+	mode   os.FileMode
+	remove bool
+
+	// The state of the file before the transaction, so it can be rolled back
+	old     []byte
+	oldMode os.FileMode
+	existed bool
+	// The temporary file the new contents are staged in
+	staged string
+	// The directories created for the file, deepest first
+	dirs []string
+}
+
+// Transaction is a set of files to write or remove, which are either all changed, or none are. The new contents are
+// written to temporary files next to the originals, and only renamed into place once they've all been written.
+type Transaction struct {
+	journal *Journal
+	changes []*change
+}
+
+// NewTransaction creates a transaction that backs up the files it changes to the journal. The journal can be nil.
+func NewTransaction(j *Journal) *Transaction {
+	return &Transaction{journal: j}
+}
+
+// WriteFile writes the file when the transaction is committed. The mode is kept if the file exists already, and
+// defaults to 0644 if mode is zero.
+func (tx *Transaction) WriteFile(path string, data []byte, mode os.FileMode) {
+	tx.changes = append(tx.changes, &change{path: path, data: data, mode: mode})
+}
+
+// Remove removes the file when the transaction is committed. Files that don't exist are skipped.
+func (tx *Transaction) Remove(path string) {
+	tx.changes = append(tx.changes, &change{path: path, remove: true})
+}
+
+// Commit makes the changes. If any of the new files can't be written, nothing is changed. If a file can't be moved into
+// place, the files that have already been changed are restored. The changes are only recorded in the journal once
+// they've all been made, and if that fails, they're rolled back.
+func (tx *Transaction) Commit() (err error) {
+	defer func() {
+		tx.cleanUp()
+		if err != nil {
+			for _, c := range tx.changes {
+				removeEmptyDirs(c.dirs)
+			}
+		}
+	}()
+
+	for _, c := range tx.changes {
+		if err := c.readOld(); err != nil {
+			return err
+		}
+		if c.remove {
+			continue
+		}
+		if err := c.stage(); err != nil {
+			return fmt.Errorf("failed to write %s: %v", c.path, err)
+		}
+	}
+
+	for i, c := range tx.changes {
+		var err error
+		if c.remove {
+			if err = os.Remove(c.path); os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = os.Rename(c.staged, c.path)
+		}
+		if err != nil {
+			if rollbackErr := rollback(tx.changes[:i]); rollbackErr != nil {
+				return fmt.Errorf("failed to update %s: %v, and then failed to restore the files already updated: %v", c.path, err, rollbackErr)
+			}
+			return fmt.Errorf("failed to update %s: %v", c.path, err)
+		}
+		c.staged = ""
+	}
+
+	if err := tx.journal.record(tx.changes); err != nil {
+		if rollbackErr := rollback(tx.changes); rollbackErr != nil {
+			return fmt.Errorf("%v, and then failed to restore the files: %v", err, rollbackErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// cleanUp removes any staged files that weren't moved into place
+func (tx *Transaction) cleanUp() {
+	for _, c := range tx.changes {
+		if c.staged != "" {
+			os.Remove(c.staged)
+			c.staged = ""
+		}
+	}
+}
+
+// readOld reads what the file contains before the transaction
+func (c *change) readOld() error {
+	info, err := os.Stat(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if c.old, err = os.ReadFile(c.path); err != nil {
+		return err
+	}
+	c.existed = true
+	c.oldMode = info.Mode().Perm()
+	return nil
+}
+
+// stage writes the new contents to a temporary file in the same directory, so it can be renamed over the original
+func (c *change) stage() error {
+	mode := c.mode
+	if c.existed {
+		mode = c.oldMode
+	} else if mode == 0 {
+		mode = 0644
+	}
+
+	dir := filepath.Dir(c.path)
+	c.dirs = missingDirs(dir)
+	if err := os.MkdirAll(dir, os.ModeDir|0775); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	c.staged = f.Name()
+
+	if _, err := f.Write(c.data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// missingDirs returns the directories that don't exist yet on the way to the directory, deepest first
+func missingDirs(dir string) []string {
+	var ret []string
+	for {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			return ret
+		}
+		ret = append(ret, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ret
+		}
+		dir = parent
+	}
+}
+
+// removeEmptyDirs removes the directories, deepest first, stopping at the first one that isn't empty
+func removeEmptyDirs(dirs []string) {
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+}
+
+// rollback restores the files to how they were before the changes were made
+func rollback(changes []*change) error {
+	tx := NewTransaction(nil)
+	for _, c := range changes {
+		if c.existed {
+			tx.WriteFile(c.path, c.old, c.oldMode)
+		} else if !c.remove {
+			tx.Remove(c.path)
+		}
+	}
+	return tx.Commit()
+}
+
+// WriteFile writes the file atomically, by writing it to a temporary file and renaming it into place
+func WriteFile(path string, data []byte, mode os.FileMode) error {
+	tx := NewTransaction(nil)
+	tx.WriteFile(path, data, mode)
+	return tx.Commit()
+}
@@ -0,0 +1,200 @@
+package licence
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/google/go-licenses/licenses"
+
+	"github.com/tatskaari/go-deps/config"
+)
+
+// DefaultThreshold is the confidence the classifier needs to identify a licence, when it's not set in the config
+const DefaultThreshold = 0.9
+
+var (
+	// textSuffix is what can follow the name of a licence, notice or README file: an upper case variant e.g. LICENSE-MIT
+	// or COPYING.LESSER, then a text extension. Source files named after them, like copyright.go, don't match.
+	textSuffix  = `([-._][A-Z0-9][A-Z0-9.-]*)?(?i:\.(txt|md|markdown|rst))?$`
+	licenceFile = regexp.MustCompile(`^(?i:LICEN[CS]E|COPYING|UNLICENSE|COPYRIGHT)` + textSuffix)
+	noticeFile  = regexp.MustCompile(`^(?i:NOTICE)` + textSuffix)
+	readmeFile  = regexp.MustCompile(`^(?i:README)` + textSuffix)
+	// dualLicensing matches the usual ways of saying a module can be used under a choice of licences e.g. "Licensed
+	// under either of Apache License, Version 2.0 or MIT license at your option"
+	dualLicensing = regexp.MustCompile(`(?i)dual[- ]licen[cs]ed|licen[cs]ed under (either|your choice)`)
+)
+
+// File is a licence file found in a module
+type File struct {
+	// Path is the path to the file, relative to the root of the module
+	Path string
+	// Licence is the SPDX identifier of the licence in the file, or empty if it couldn't be identified
+	Licence string
+}
+
+// Detection is the licences found in a module
+type Detection struct {
+	// Licence is the SPDX expression for the module. All the licences found apply e.g. MIT AND BSD-3-Clause, unless the
+	// module says it's dual licensed in the README or a licence file at its root, in which case the licences at the root
+	// are alternatives e.g. (MIT OR Apache-2.0) AND BSD-3-Clause.
+	Licence string
+	// Files are the licence files in the module, sorted by path
+	Files []File
+	// Notices are the paths to the NOTICE files in the module, relative to its root
+	Notices []string
+	// Warnings are problems that didn't stop the licence being detected, like files the classifier couldn't identify
+	Warnings []string
+}
+
+// Detector finds the licences of modules by classifying every licence file in them
+type Detector struct {
+	classifier licenses.Classifier
+	// Overrides are the SPDX expressions to use for modules the classifier can't identify, keyed by module path
+	Overrides map[string]string
+}
+
+// NewDetector creates a detector that needs the given confidence to identify a licence
+func NewDetector(threshold float64, overrides map[string]string) (*Detector, error) {
+	c, err := licenses.NewClassifier(threshold)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the licence classifier: %v", err)
+	}
+	return newDetector(c, overrides), nil
+}
+
+func newDetector(c licenses.Classifier, overrides map[string]string) *Detector {
+	if overrides == nil {
+		overrides = map[string]string{}
+	}
+	return &Detector{classifier: c, Overrides: overrides}
+}
+
+// LoadDetector creates a detector from the config. The threshold is set with threshold in the [licences] section, and
+// the licences of modules are overridden with [licenceoverride "module"] sections e.g.
+//
+//	[licenceoverride "example.com/module"]
+//	licence = MIT OR Apache-2.0
+func LoadDetector(c config.Config) (*Detector, error) {
+	threshold := DefaultThreshold
+	if s := c.GetString("licences", "threshold"); s != "" {
+		t, err := strconv.ParseFloat(s, 64)
+		if err != nil || t <= 0 || t > 1 {
+			return nil, fmt.Errorf("the licence threshold in %s must be a number between 0 and 1, not %q", config.FileName, s)
+		}
+		threshold = t
+	}
+
+	overrides := map[string]string{}
+	for _, module := range c.Subsections("licenceoverride") {
+		l := c.GetString(fmt.Sprintf("licenceoverride %q", module), "licence")
+		if _, err := parseExpression(l); err != nil {
+			return nil, fmt.Errorf("the licence override for %s in %s is invalid: %v", module, config.FileName, err)
+		}
+		overrides[module] = l
+	}
+	return NewDetector(threshold, overrides)
+}
+
+// Detect finds the licences in the module, which has been downloaded to the directory. Vendored code, test data and
+// hidden directories are skipped. Files that can't be identified are reported as warnings rather than failing the
+// detection. If the module has an override, that's used as its licence, but the files are still reported.
+func (d *Detector) Detect(module, dir string) (*Detection, error) {
+	ret := new(Detection)
+	dual := false
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if path != dir && (name == "vendor" || name == "testdata" || name[0] == '.' || name[0] == '_') {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if path == filepath.Join(dir, name) && !dual && (licenceFile.MatchString(name) || readmeFile.MatchString(name)) {
+			if dual, err = declaresDualLicensing(path); err != nil {
+				return err
+			}
+		}
+		switch {
+		case noticeFile.MatchString(name):
+			ret.Notices = append(ret.Notices, rel)
+		case licenceFile.MatchString(name):
+			licence, _, err := d.classifier.Identify(path)
+			if err != nil {
+				ret.Warnings = append(ret.Warnings, fmt.Sprintf("couldn't identify the licence in %s: %v", rel, err))
+			}
+			ret.Files = append(ret.Files, File{Path: rel, Licence: licence})
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	sort.Slice(ret.Files, func(i, j int) bool {
+		return ret.Files[i].Path < ret.Files[j].Path
+	})
+	sort.Strings(ret.Notices)
+
+	if override, ok := d.Overrides[module]; ok {
+		ret.Licence = override
+	} else {
+		ret.Licence = expressionFor(ret.Files, dual)
+	}
+	return ret, nil
+}
+
+// declaresDualLicensing returns true if the file says the module can be used under a choice of licences
+func declaresDualLicensing(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return dualLicensing.Match(data), nil
+}
+
+// expressionFor builds the SPDX expression for the licence files. Every licence found applies, unless the module is dual
+// licensed, in which case the licences in the root of the module are offered as alternatives, and those in
+// subdirectories that aren't the same as one at the root also apply.
+func expressionFor(files []File, dual bool) string {
+	var root, nested []string
+	seen := map[string]struct{}{}
+	for _, f := range files {
+		if f.Licence == "" || filepath.Dir(f.Path) != "." {
+			continue
+		}
+		if _, ok := seen[f.Licence]; !ok {
+			seen[f.Licence] = struct{}{}
+			root = append(root, f.Licence)
+		}
+	}
+	for _, f := range files {
+		if f.Licence == "" {
+			continue
+		}
+		if _, ok := seen[f.Licence]; !ok {
+			seen[f.Licence] = struct{}{}
+			nested = append(nested, f.Licence)
+		}
+	}
+	if !dual {
+		all := append(root, nested...)
+		sort.Strings(all)
+		return And(all...)
+	}
+	sort.Strings(root)
+	sort.Strings(nested)
+	return And(append([]string{Or(root...)}, nested...)...)
+}
@@ -0,0 +1,149 @@
+package licence
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-licenses/licenses"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/config"
+)
+
+// fakeClassifier identifies licence files that contain the name of the licence
+type fakeClassifier struct{}
+
+func (fakeClassifier) Identify(path string) (string, licenses.Type, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	content := strings.TrimSpace(string(data))
+	if content == "" || strings.Contains(content, " ") {
+		return "", "", fmt.Errorf("unknown license")
+	}
+	return content, licenses.Unknown, nil
+}
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestDetect(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"LICENSE-MIT":              "MIT",
+		"LICENSE-APACHE":           "Apache-2.0",
+		"README.md":                "Licensed under either of Apache-2.0 or MIT at your option.",
+		"NOTICE":                   "Copyright example.com",
+		"internal/third/COPYING":   "BSD-3-Clause",
+		"internal/other/LICENSE":   "MIT",
+		"internal/custom/LICENCE":  "Do what you like with it",
+		"vendor/example/LICENSE":   "GPL-3.0",
+		"testdata/LICENSE":         "GPL-3.0",
+		".github/LICENSE":          "GPL-3.0",
+		"licensing.go":             "package foo",
+		"internal/third/NOTICE.md": "Copyright example.org",
+	})
+
+	d := newDetector(fakeClassifier{}, nil)
+	detection, err := d.Detect("example.com/foo", dir)
+	require.NoError(t, err)
+
+	require.Equal(t, "(Apache-2.0 OR MIT) AND BSD-3-Clause", detection.Licence)
+	require.Equal(t, []File{
+		{Path: "LICENSE-APACHE", Licence: "Apache-2.0"},
+		{Path: "LICENSE-MIT", Licence: "MIT"},
+		{Path: filepath.Join("internal", "custom", "LICENCE")},
+		{Path: filepath.Join("internal", "other", "LICENSE"), Licence: "MIT"},
+		{Path: filepath.Join("internal", "third", "COPYING"), Licence: "BSD-3-Clause"},
+	}, detection.Files)
+	require.Equal(t, []string{"NOTICE", filepath.Join("internal", "third", "NOTICE.md")}, detection.Notices)
+	require.Len(t, detection.Warnings, 1)
+	require.Contains(t, detection.Warnings[0], filepath.Join("internal", "custom", "LICENCE"))
+}
+
+func TestDetectCombinesLicencesWithAndUnlessDualLicensed(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"LICENSE":          "MIT",
+		"COPYING":          "GPL-3.0",
+		"internal/LICENSE": "BSD-3-Clause",
+	})
+
+	d := newDetector(fakeClassifier{}, nil)
+	detection, err := d.Detect("example.com/foo", dir)
+	require.NoError(t, err)
+	require.Equal(t, "BSD-3-Clause AND GPL-3.0 AND MIT", detection.Licence)
+
+	// Saying so in a licence file is enough too
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "LICENSE-CHOICE"), []byte("This is dual-licensed under MIT or GPL-3.0."), 0644))
+	detection, err = d.Detect("example.com/foo", dir)
+	require.NoError(t, err)
+	require.Equal(t, "(GPL-3.0 OR MIT) AND BSD-3-Clause", detection.Licence)
+}
+
+func TestDetectIgnoresSourceFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"LICENSE.txt":            "MIT",
+		"COPYING.LESSER":         "LGPL-3.0",
+		"copyright/copyright.go": "package copyright",
+		"license.go":             "package foo",
+		"license_test.go":        "package foo",
+		"notice.go":              "package foo",
+	})
+
+	d := newDetector(fakeClassifier{}, nil)
+	detection, err := d.Detect("example.com/foo", dir)
+	require.NoError(t, err)
+	require.Equal(t, []File{
+		{Path: "COPYING.LESSER", Licence: "LGPL-3.0"},
+		{Path: "LICENSE.txt", Licence: "MIT"},
+	}, detection.Files)
+	require.Empty(t, detection.Notices)
+	require.Empty(t, detection.Warnings)
+}
+
+func TestDetectOverride(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"LICENSE": "Some bespoke licence",
+	})
+
+	d := newDetector(fakeClassifier{}, nil)
+	detection, err := d.Detect("example.com/foo", dir)
+	require.NoError(t, err)
+	require.Equal(t, "", detection.Licence)
+	require.Equal(t, []File{{Path: "LICENSE"}}, detection.Files)
+
+	d.Overrides["example.com/foo"] = "BSD-2-Clause"
+	detection, err = d.Detect("example.com/foo", dir)
+	require.NoError(t, err)
+	require.Equal(t, "BSD-2-Clause", detection.Licence)
+}
+
+func TestLoadDetector(t *testing.T) {
+	d, err := LoadDetector(config.Config{
+		"licences": {"threshold": {"0.8"}},
+		`licenceoverride "example.com/foo"`: {
+			"licence": {"MIT OR Apache-2.0"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"example.com/foo": "MIT OR Apache-2.0"}, d.Overrides)
+
+	_, err = LoadDetector(config.Config{"licences": {"threshold": {"90%"}}})
+	require.Error(t, err)
+
+	_, err = LoadDetector(config.Config{
+		`licenceoverride "example.com/foo"`: {"licence": {"MIT OR"}},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,181 @@
+// Package licence decides whether the licences of third party modules are allowed in the repo
+package licence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tatskaari/go-deps/config"
+)
+
+// Status is the outcome of checking a module's licence against the policy
+type Status int
+
+const (
+	// Allowed means the licence is allowed by the policy
+	Allowed Status = iota
+	// Unknown means we couldn't work out the module's licence
+	Unknown
+	// Denied means the licence is rejected by the policy, or isn't one of the accepted licences
+	Denied
+	// Excepted means the module would be denied, or its licence is unknown, but it has an exception
+	Excepted
+)
+
+func (s Status) String() string {
+	switch s {
+	case Allowed:
+		return "allowed"
+	case Unknown:
+		return "unknown"
+	case Denied:
+		return "denied"
+	case Excepted:
+		return "excepted"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Policy is the licences that are allowed in the repo. It's read from the [licences] section of the .plzconfig, so
+// go-deps agrees with Please, and the .godepsconfig, which can also set exceptions for individual modules.
+type Policy struct {
+	// Accept is the licences that are allowed. If this is empty, any licence that isn't rejected is allowed.
+	Accept []string
+	// Reject is the licences that aren't allowed
+	Reject []string
+	// RejectUnknown denies modules when we can't work out their licence, rather than just flagging them
+	RejectUnknown bool
+	// Exceptions are the modules that are allowed whatever their licence, mapped to the justification for allowing them
+	Exceptions map[string]string
+}
+
+// LoadPolicy reads the licence policy from the .plzconfig and .godepsconfig in the root of the repo. Every exception
+// must have a justification.
+func LoadPolicy(root string) (*Policy, error) {
+	c, err := config.ReadRepo(root)
+	if err != nil {
+		return nil, err
+	}
+	return NewPolicy(c)
+}
+
+// NewPolicy creates the licence policy from the config
+func NewPolicy(c config.Config) (*Policy, error) {
+	p := &Policy{
+		Accept:        c.Get("licences", "accept"),
+		Reject:        c.Get("licences", "reject"),
+		RejectUnknown: c.GetBool("licences", "rejectunknown"),
+		Exceptions:    map[string]string{},
+	}
+	for _, module := range c.Subsections("licenceexception") {
+		justification := c.GetString(fmt.Sprintf("licenceexception %q", module), "justification")
+		if justification == "" {
+			return nil, fmt.Errorf("the licence exception for %s in %s must have a justification", module, config.FileName)
+		}
+		p.Exceptions[module] = justification
+	}
+	return p, nil
+}
+
+// IsEmpty returns true if the policy doesn't restrict any licences
+func (p *Policy) IsEmpty() bool {
+	return len(p.Accept) == 0 && len(p.Reject) == 0 && !p.RejectUnknown
+}
+
+// Verdict is the outcome of checking a module's licence against the policy
+type Verdict struct {
+	Module  string
+	Licence string
+	Status  Status
+	// Why the module was denied, or the justification for its exception
+	Reason string
+}
+
+func (v Verdict) String() string {
+	licence := v.Licence
+	if licence == "" {
+		licence = "unknown licence"
+	}
+	return fmt.Sprintf("%s (%s): %s", v.Module, licence, v.Reason)
+}
+
+// Check checks the licence of the module against the policy. The licence is an SPDX expression, so every licence joined
+// with AND must be allowed, but only one of those joined with OR needs to be. The licence is empty if it couldn't be
+// detected.
+func (p *Policy) Check(module, licence string) Verdict {
+	v := Verdict{Module: module, Licence: licence, Status: Allowed}
+	if licence == "" {
+		v.Status = Unknown
+		v.Reason = "couldn't detect its licence"
+		if p.RejectUnknown {
+			v.Status = Denied
+		}
+	} else if expr, err := parseExpression(licence); err != nil {
+		v.Status = Denied
+		v.Reason = err.Error()
+	} else if ok, reasons := expr.allowed(p.allows); !ok {
+		v.Status = Denied
+		v.Reason = strings.Join(reasons, ", ")
+	}
+
+	if justification, ok := p.Exceptions[module]; ok && v.Status != Allowed {
+		v.Status = Excepted
+		v.Reason = justification
+	}
+	return v
+}
+
+// Offenders returns the verdicts that are denied, sorted by module
+func Offenders(verdicts []Verdict) []Verdict {
+	var ret []Verdict
+	for _, v := range verdicts {
+		if v.Status == Denied {
+			ret = append(ret, v)
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Module < ret[j].Module
+	})
+	return ret
+}
+
+// PolicyError is returned when modules have licences that the policy doesn't allow
+type PolicyError struct {
+	Offenders []Verdict
+}
+
+func (e *PolicyError) Error() string {
+	lines := make([]string, 0, len(e.Offenders)+1)
+	lines = append(lines, fmt.Sprintf("%d module(s) have licences that aren't allowed:", len(e.Offenders)))
+	for _, v := range e.Offenders {
+		lines = append(lines, "  "+v.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// allows checks a single licence from an expression against the policy, returning why it's denied if it is. Licences
+// with an exception e.g. GPL-2.0 WITH Classpath-exception-2.0 match the policy on their own, or without the exception.
+func (p *Policy) allows(licence string) (bool, string) {
+	base := licence
+	if i := strings.Index(strings.ToUpper(licence), " WITH "); i >= 0 {
+		base = licence[:i]
+	}
+	switch {
+	case contains(p.Reject, licence) || contains(p.Reject, base):
+		return false, fmt.Sprintf("%s is rejected", licence)
+	case len(p.Accept) > 0 && !contains(p.Accept, licence) && !contains(p.Accept, base):
+		return false, fmt.Sprintf("%s isn't one of the accepted licences", licence)
+	}
+	return true, ""
+}
+
+// contains returns true if the licence is in the list. Licences are compared case insensitively.
+func contains(licences []string, licence string) bool {
+	for _, l := range licences {
+		if strings.EqualFold(l, licence) {
+			return true
+		}
+	}
+	return false
+}
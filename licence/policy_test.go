@@ -0,0 +1,64 @@
+package licence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/config"
+)
+
+func TestCheck(t *testing.T) {
+	p, err := NewPolicy(config.Config{
+		"licences": {
+			"accept": {"MIT", "Apache-2.0", "AGPL-3.0"},
+			"reject": {"AGPL-3.0"},
+		},
+		`licenceexception "example.com/legacy"`: {
+			"justification": {"Only used by the internal admin tool, approved by legal"},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, Allowed, p.Check("example.com/foo", "mit").Status)
+	require.Equal(t, Denied, p.Check("example.com/foo", "AGPL-3.0").Status)
+	require.Equal(t, Denied, p.Check("example.com/foo", "GPL-2.0").Status)
+	require.Equal(t, Unknown, p.Check("example.com/foo", "").Status)
+	require.Equal(t, Verdict{
+		Module:  "example.com/legacy",
+		Licence: "AGPL-3.0",
+		Status:  Excepted,
+		Reason:  "Only used by the internal admin tool, approved by legal",
+	}, p.Check("example.com/legacy", "AGPL-3.0"))
+	require.Equal(t, Allowed, p.Check("example.com/legacy", "MIT").Status)
+
+	// Any of the licences joined with OR can be chosen, but all of those joined with AND apply
+	require.Equal(t, Allowed, p.Check("example.com/foo", "GPL-2.0 OR MIT").Status)
+	require.Equal(t, Allowed, p.Check("example.com/foo", "(MIT OR GPL-2.0) AND Apache-2.0").Status)
+	require.Equal(t, Verdict{
+		Module:  "example.com/foo",
+		Licence: "MIT AND (AGPL-3.0 OR GPL-2.0)",
+		Status:  Denied,
+		Reason:  "AGPL-3.0 is rejected, GPL-2.0 isn't one of the accepted licences",
+	}, p.Check("example.com/foo", "MIT AND (AGPL-3.0 OR GPL-2.0)"))
+	require.Equal(t, Denied, p.Check("example.com/foo", "MIT AND").Status)
+
+	p.RejectUnknown = true
+	require.Equal(t, Denied, p.Check("example.com/foo", "").Status)
+
+	err = &PolicyError{Offenders: Offenders([]Verdict{
+		p.Check("example.com/foo", "AGPL-3.0"),
+		p.Check("example.com/bar", "MIT"),
+		p.Check("example.com/baz", ""),
+	})}
+	require.Equal(t, `2 module(s) have licences that aren't allowed:
+  example.com/baz (unknown licence): couldn't detect its licence
+  example.com/foo (AGPL-3.0): AGPL-3.0 is rejected`, err.Error())
+}
+
+func TestExceptionsNeedJustification(t *testing.T) {
+	_, err := NewPolicy(config.Config{
+		`licenceexception "example.com/legacy"`: {},
+	})
+	require.Error(t, err)
+}
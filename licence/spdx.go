@@ -0,0 +1,229 @@
+package licence
+
+import (
+	"fmt"
+	"strings"
+)
+
+// expression is a parsed SPDX licence expression e.g. MIT OR (Apache-2.0 AND BSD-3-Clause). It's either a single
+// licence, or an AND or OR of other expressions.
+type expression struct {
+	// op is AND or OR, or empty for a single licence
+	op      string
+	licence string
+	args    []*expression
+}
+
+// Or combines the licences into an SPDX expression where any of them can be chosen
+func Or(licences ...string) string {
+	return join("OR", licences)
+}
+
+// And combines the licences into an SPDX expression where all of them apply
+func And(licences ...string) string {
+	return join("AND", licences)
+}
+
+// IsExpression returns true if the licence is a valid SPDX expression
+func IsExpression(licence string) bool {
+	_, err := parseExpression(licence)
+	return err == nil
+}
+
+// Alternatives splits an SPDX expression into the licences that can be chosen between e.g. MIT OR Apache-2.0 gives MIT
+// and Apache-2.0. This is how Please's licences attribute lists them. Expressions that can't be split are returned as
+// they are.
+func Alternatives(licence string) []string {
+	expr, err := parseExpression(licence)
+	if err != nil || expr.op != "OR" {
+		return []string{licence}
+	}
+	ret := make([]string, 0, len(expr.args))
+	for _, arg := range expr.args {
+		ret = append(ret, arg.String())
+	}
+	return ret
+}
+
+func (e *expression) String() string {
+	if e.op == "" {
+		return e.licence
+	}
+	args := make([]string, 0, len(e.args))
+	for _, arg := range e.args {
+		args = append(args, arg.String())
+	}
+	return join(e.op, args)
+}
+
+// join joins the licences with the operator, wrapping any compound expressions in brackets
+func join(op string, licences []string) string {
+	parts := make([]string, 0, len(licences))
+	for _, l := range licences {
+		if l != "" {
+			parts = append(parts, l)
+		}
+	}
+	for i, l := range parts {
+		if len(parts) > 1 && isCompound(l) {
+			parts[i] = "(" + l + ")"
+		}
+	}
+	return strings.Join(parts, " "+op+" ")
+}
+
+// isCompound returns true if the expression joins licences with AND or OR outside of any brackets
+func isCompound(s string) bool {
+	depth := 0
+	for _, tok := range tokenise(s) {
+		switch {
+		case tok == "(":
+			depth++
+		case tok == ")":
+			depth--
+		case depth == 0 && (strings.EqualFold(tok, "AND") || strings.EqualFold(tok, "OR")):
+			return true
+		}
+	}
+	return false
+}
+
+// parseExpression parses an SPDX licence expression. AND binds tighter than OR, as in the spec. Exceptions added with
+// WITH are kept as part of the licence, and the operators are case insensitive.
+func parseExpression(s string) (*expression, error) {
+	p := &parser{tokens: tokenise(s)}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("empty licence expression")
+	}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in licence expression %q", p.tokens[p.pos], s)
+	}
+	return expr, nil
+}
+
+// tokenise splits the expression into brackets and words
+func tokenise(s string) []string {
+	var tokens []string
+	word := strings.Builder{}
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+	for _, c := range s {
+		switch c {
+		case '(', ')':
+			flush()
+			tokens = append(tokens, string(c))
+		case ' ', '\t', '\n':
+			flush()
+		default:
+			word.WriteRune(c)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) or() (*expression, error) {
+	return p.binary("OR", p.and)
+}
+
+func (p *parser) and() (*expression, error) {
+	return p.binary("AND", p.term)
+}
+
+// binary parses one or more operands separated by the operator
+func (p *parser) binary(op string, operand func() (*expression, error)) (*expression, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	args := []*expression{first}
+	for strings.EqualFold(p.peek(), op) {
+		p.pos++
+		next, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, next)
+	}
+	if len(args) == 1 {
+		return first, nil
+	}
+	return &expression{op: op, args: args}, nil
+}
+
+// term parses a bracketed expression, or a single licence with an optional exception
+func (p *parser) term() (*expression, error) {
+	tok := p.peek()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("licence expression ended early")
+	case tok == "(":
+		p.pos++
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing closing bracket in licence expression")
+		}
+		p.pos++
+		return expr, nil
+	case tok == ")" || strings.EqualFold(tok, "AND") || strings.EqualFold(tok, "OR") || strings.EqualFold(tok, "WITH"):
+		return nil, fmt.Errorf("expected a licence but got %q", tok)
+	}
+	p.pos++
+	licence := tok
+	if strings.EqualFold(p.peek(), "WITH") {
+		p.pos++
+		exception := p.peek()
+		if exception == "" || exception == "(" || exception == ")" {
+			return nil, fmt.Errorf("expected an exception after WITH in licence expression")
+		}
+		p.pos++
+		licence += " WITH " + exception
+	}
+	return &expression{licence: licence}, nil
+}
+
+// allowed evaluates the expression, using the function to check each licence. All the licences of an AND must be
+// allowed, but only one of the licences of an OR needs to be. The reasons each licence that stopped the expression being
+// allowed was denied are returned.
+func (e *expression) allowed(check func(licence string) (bool, string)) (bool, []string) {
+	if e.op == "" {
+		ok, reason := check(e.licence)
+		if ok {
+			return true, nil
+		}
+		return false, []string{reason}
+	}
+
+	var reasons []string
+	for _, arg := range e.args {
+		ok, argReasons := arg.allowed(check)
+		if ok && e.op == "OR" {
+			return true, nil
+		}
+		reasons = append(reasons, argReasons...)
+	}
+	return len(reasons) == 0, reasons
+}
@@ -0,0 +1,33 @@
+package licence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpression(t *testing.T) {
+	expr, err := parseExpression("MIT or (Apache-2.0 AND GPL-2.0 WITH Classpath-exception-2.0) OR BSD-3-Clause")
+	require.NoError(t, err)
+	require.Equal(t, "MIT OR (Apache-2.0 AND GPL-2.0 WITH Classpath-exception-2.0) OR BSD-3-Clause", expr.String())
+
+	// AND binds tighter than OR
+	expr, err = parseExpression("MIT AND Apache-2.0 OR BSD-3-Clause")
+	require.NoError(t, err)
+	require.Equal(t, "OR", expr.op)
+	require.Equal(t, "(MIT AND Apache-2.0) OR BSD-3-Clause", expr.String())
+
+	for _, invalid := range []string{"", "MIT OR", "(MIT", "MIT)", "AND MIT", "MIT WITH"} {
+		_, err := parseExpression(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	require.Equal(t, "MIT", Or("MIT"))
+	require.Equal(t, "MIT OR Apache-2.0", Or("MIT", "", "Apache-2.0"))
+	require.Equal(t, "(MIT OR Apache-2.0) AND BSD-3-Clause", And("MIT OR Apache-2.0", "BSD-3-Clause"))
+	require.Equal(t, "BSD-3-Clause", And("", "BSD-3-Clause"))
+	require.Equal(t, []string{"MIT", "Apache-2.0 AND BSD-3-Clause"}, Alternatives("MIT OR (Apache-2.0 AND BSD-3-Clause)"))
+	require.Equal(t, []string{"MIT AND BSD-3-Clause"}, Alternatives("MIT AND BSD-3-Clause"))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tatskaari/go-deps/licence"
+	"github.com/tatskaari/go-deps/rules"
+	"github.com/tatskaari/go-deps/scan"
+)
+
+type licencesCommand struct{}
+
+// Execute checks the licences set on the existing third party rules against the licence policy, listing any modules
+// that aren't allowed
+func (cmd *licencesCommand) Execute(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	moduleGraph, _, err := parseRules()
+	if err != nil {
+		return err
+	}
+	policy, err := licence.LoadPolicy(".")
+	if err != nil {
+		return err
+	}
+
+	var verdicts []licence.Verdict
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		verdicts = append(verdicts, checkRuleLicences(policy, m.Name, moduleGraph.Licences(m)))
+	}
+	return reportLicences(verdicts)
+}
+
+// checkRuleLicences checks the licences on a module's rules. Like Please, the module is allowed if any of them are.
+func checkRuleLicences(policy *licence.Policy, module string, licences []string) licence.Verdict {
+	return policy.Check(module, licence.Or(licences...))
+}
+
+// checkLicences checks the licences of the modules that are being added or updated against the licence policy, so
+// modules with licences that aren't allowed are never written
+func checkLicences(moduleGraph *rules.BuildGraph) error {
+	policy, err := licence.LoadPolicy(".")
+	if err != nil {
+		return err
+	}
+	if policy.IsEmpty() {
+		return nil
+	}
+
+	modulePath := scan.ModulePath(".")
+	var verdicts []licence.Verdict
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if !m.IsModified() || scan.IsFirstParty(m.Name, modulePath) {
+			continue
+		}
+		verdicts = append(verdicts, policy.Check(m.Name, m.Licence))
+	}
+	return reportLicences(verdicts)
+}
+
+// reportLicences prints the modules that have unknown licences, or exceptions, and returns an error listing the modules
+// that are denied, if there are any
+func reportLicences(verdicts []licence.Verdict) error {
+	for _, v := range verdicts {
+		switch v.Status {
+		case licence.Unknown:
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", v)
+		case licence.Excepted:
+			fmt.Fprintf(os.Stderr, "Allowing %s by exception: %s\n", v.Module, v.Reason)
+		}
+	}
+	if offenders := licence.Offenders(verdicts); len(offenders) > 0 {
+		return &licence.PolicyError{Offenders: offenders}
+	}
+	return nil
+}
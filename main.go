@@ -1,14 +1,23 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/jessevdk/go-flags"
 
+	"github.com/tatskaari/go-deps/config"
+	"github.com/tatskaari/go-deps/journal"
+	"github.com/tatskaari/go-deps/licence"
+	"github.com/tatskaari/go-deps/please"
+	"github.com/tatskaari/go-deps/policy"
 	"github.com/tatskaari/go-deps/resolve"
 	"github.com/tatskaari/go-deps/resolve/driver"
 	"github.com/tatskaari/go-deps/rules"
@@ -18,18 +27,49 @@ var opts struct {
 	ThirdPartyFolder string `long:"third_party" default:"third_party/go" description:"The location of the folder containing your third party build rules."`
 	Structured       bool   `long:"structured" short:"s" description:"Whether to produce a structured directory tree for each module. Defaults to a flat BUILD file for all third party rules."`
 	Write            bool   `long:"write" short:"w" description:"Whether write the rules back to the BUILD files. Prints to stdout by default."`
+	Check            bool   `long:"check" description:"Check the third party rules are up to date, and free of structural problems, without writing anything. Every installed package is resolved again at its current version, along with any packages passed in. Exits with an error, printing a diff, if any rules would change."`
+	Diff             bool   `long:"diff" description:"Print a unified diff of the BUILD files that would change, and a summary of the modules that would change, rather than the whole files. Ignored with -w."`
 	PleaseTool       string `long:"please_tool" default:"plz" description:"The path to the Please binary."`
 	GoTool           string `long:"go_tool" default:"plz" description:"The path to the Please binary."`
 	BuildFileName    string `long:"build_file_name" default:"BUILD" description:"The filename to use for BUILD files. Defaults to BUILD."`
-	Args             struct {
-		Packages []string `positional-arg-name:"packages" description:"Packages to install following 'go get' style patters. These can optionally have versions e.g. github.com/example/module/...@v1.0.0"`
-	} `positional-args:"true"`
+	PartReport       bool   `long:"part_report" description:"Print a report comparing how many parts each module is split into before and after updating."`
+	KeepParts        bool   `long:"keep_parts" description:"Don't merge the parts of modules back together when they're no longer needed to break a cycle."`
+	SkipHashes       bool   `long:"skip_hashes" description:"Don't compute the hashes of the modules that are updated. Hashes are only computed when writing the rules."`
+	GoRepo           bool   `long:"go_repo" description:"Write go_repo() rules rather than go_module() rules. This is the default if the third party rules use go_repo() already."`
+	VerifyHashes     bool   `long:"verify_hashes" description:"Check the hashes of the existing rules match what's downloaded, rather than installing packages."`
+	Backend          string `long:"backend" default:"please" choice:"please" choice:"bazel" description:"The build system to write rules for. Bazel uses rules_go's go_repository() rules."`
+	BazelDeps        string `long:"bazel_deps" default:"deps.bzl" description:"The file containing the go_repository() rules for the Bazel backend e.g. deps.bzl or MODULE.bazel."`
+
+	Graph    graphCommand    `command:"graph" description:"Prints the module graph in DOT or JSON format."`
+	Licences licencesCommand `command:"licences" description:"Checks the licences of the third party modules against the licence policy in the .plzconfig and .godepsconfig."`
+	Migrate  migrateCommand  `command:"migrate" description:"Converts the existing third party rules to another kind of rule e.g. go_repo(), or to the structured or flat layout."`
+	Notices  noticesCommand  `command:"notices" description:"Collects the licence and NOTICE texts of the third party modules, or those the targets passed in depend on, into one file."`
+	SBOM     sbomCommand     `command:"sbom" description:"Writes a software bill of materials for the third party modules, or those the targets passed in depend on, in SPDX or CycloneDX format."`
+	Audit    auditCommand    `command:"audit" description:"Checks the versions of the third party modules against a local copy of the Go vulnerability database, without using the network."`
+	Policy   policyCommand   `command:"policy" description:"Checks the third party modules against the module policy in the .godepsconfig."`
+	Fix      fixCommand      `command:"fix" description:"Adds modules for any third party packages imported by your Go code that aren't provided by a go_module() yet."`
+	Narrow   narrowCommand   `command:"narrow" description:"Replaces wildcard installs with just the packages that are used, pinned to the current version. Narrows all modules unless some are passed in."`
+	Validate validateCommand `command:"validate" description:"Checks the existing third party rules for cycles, deps on rules that don't exist, and download labels that aren't go_mod_download() rules, printing where each problem is."`
+	Undo     undoCommand     `command:"undo" description:"Restores the files changed by the last run of go-deps that wrote anything, from the backup it kept in plz-out. Run it again to undo the run before that."`
+	Sync     syncCommand     `command:"sync" description:"Updates the deps of your go_library(), go_binary() and go_test() rules to match the third party packages they import."`
 }
 
+// runJournal backs up the files this run changes, so go-deps undo can restore them
+var runJournal = journal.New(journal.Dir)
+
+const usage = `[OPTIONS] [packages...]
+
+Packages to install follow 'go get' style patterns. These can optionally have versions e.g.
+github.com/example/module/...@v1.0.0`
+
 // This binary will accept a module name and optionally a semver or commit hash, and will add this module to a BUILD file.
 func main() {
 	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
-	if _, err := parser.Parse(); err != nil {
+	parser.SubcommandsOptional = true
+	parser.Usage = usage
+
+	packages, err := parser.Parse()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Godeps is a developer productivity tool for the Please build system.\n"+
 			"It can add and updates third party modules to your project through \nan interface that should feel familiar to those used to `go get`.\n\n"+
 			"Example usage: \n"+
@@ -38,34 +78,282 @@ func main() {
 		os.Exit(1)
 	}
 
-	moduleGraph := rules.NewGraph(opts.BuildFileName)
-	if opts.Structured {
-		err := filepath.Walk(opts.ThirdPartyFolder, func(path string, info fs.FileInfo, err error) error {
-			if info.IsDir() {
-				return nil
-			}
-			if filepath.Base(path) == opts.BuildFileName {
-				if err := moduleGraph.ReadRules(path); err != nil {
-					return err
-				}
-			}
-			return nil
-		})
-		if err != nil {
-			log.Fatal(err)
-		}
-	} else {
-		if err := moduleGraph.ReadRules(filepath.Join(opts.ThirdPartyFolder, opts.BuildFileName)); err != nil {
+	// Subcommands are run by the parser. Otherwise we're installing packages.
+	if parser.Active != nil {
+		return
+	}
+
+	if opts.Check {
+		if err := check(packages); err != nil {
 			log.Fatal(err)
 		}
+		return
 	}
 
-	err := resolve.UpdateModules(opts.GoTool, moduleGraph.Modules, opts.Args.Packages, driver.NewPleaseDriver(opts.PleaseTool, opts.GoTool, opts.ThirdPartyFolder))
+	moduleGraph, structured, err := readRules()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err := moduleGraph.Format(opts.Structured, opts.Write, opts.ThirdPartyFolder); err != nil {
+	if opts.VerifyHashes {
+		if err := requirePlease("--verify_hashes"); err != nil {
+			log.Fatal(err)
+		}
+		if err := verifyHashes(moduleGraph); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := update(moduleGraph, structured, packages); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// update resolves the packages, updates the modules in the graph, and writes the rules back out in the layout passed in
+func update(moduleGraph *rules.BuildGraph, structured bool, packages []string) error {
+	before := moduleGraph.Modules.Snapshot()
+	if err := resolveRules(moduleGraph, structured, packages); err != nil {
+		return err
+	}
+
+	if err := writeRules(moduleGraph); err != nil {
+		return err
+	}
+	if opts.Diff && !opts.Write {
+		if err := resolve.WriteSummary(os.Stderr, before, moduleGraph.Modules.Snapshot()); err != nil {
+			return err
+		}
+	}
+
+	// Please needs the rules to be written so it can download the modules to hash them. If that fails, the rules are
+	// put back how they were, rather than leaving them without hashes.
+	if opts.Write && !opts.SkipHashes {
+		if err := updateHashes(moduleGraph); err != nil {
+			if _, undoErr := runJournal.Undo(); undoErr != nil {
+				return fmt.Errorf("%v, and then failed to undo the changes: %v", err, undoErr)
+			}
+			return fmt.Errorf("%v. The changes have been undone", err)
+		}
+	}
+	return nil
+}
+
+// resolveRules resolves the packages, updates the modules in the graph, and updates their rules, without writing them
+func resolveRules(moduleGraph *rules.BuildGraph, structured bool, packages []string) error {
+	c, err := config.ReadRepo(".")
+	if err != nil {
+		return err
+	}
+	detector, err := licence.LoadDetector(c)
+	if err != nil {
+		return err
+	}
+	modulePolicy, err := policy.New(c)
+	if err != nil {
+		return err
+	}
+
+	partsBefore := moduleGraph.Modules.PartCounts()
+	err = resolve.UpdateModules(opts.GoTool, moduleGraph.Modules, packages, driver.NewPleaseDriver(opts.PleaseTool, opts.GoTool, opts.ThirdPartyFolder, modulePolicy), resolve.Options{
+		KeepParts: opts.KeepParts,
+		Licences:  detector,
+		Policy:    modulePolicy,
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.PartReport {
+		if err := resolve.WritePartReport(os.Stderr, partsBefore, moduleGraph.Modules.PartCounts()); err != nil {
+			return err
+		}
+	}
+
+	if err := checkLicences(moduleGraph); err != nil {
+		return err
+	}
+
+	return moduleGraph.Update(structured, opts.ThirdPartyFolder)
+}
+
+// updateHashes computes the hashes for any rules that download modules that have been updated, and writes them back
+func updateHashes(moduleGraph *rules.BuildGraph) error {
+	targets := moduleGraph.HashTargets()
+	if len(targets) == 0 {
+		return nil
+	}
+
+	hashes, err := please.Hash(opts.PleaseTool, targets...)
+	if err != nil {
+		return err
+	}
+	moduleGraph.SetHashes(hashes)
+	return moduleGraph.Write(true)
+}
+
+// verifyHashes checks the hashes of the rules that download modules match the hashes Please computes for them
+func verifyHashes(moduleGraph *rules.BuildGraph) error {
+	existing := moduleGraph.Hashes()
+	labels := make([]string, 0, len(existing))
+	for label := range existing {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	hashes, err := please.Hash(opts.PleaseTool, labels...)
+	if err != nil {
+		return err
+	}
+
+	mismatches := 0
+	for _, label := range labels {
+		if !contains(existing[label], hashes[label]) {
+			fmt.Fprintf(os.Stderr, "%s: expected one of %v but got %s\n", label, existing[label], hashes[label])
+			mismatches++
+		}
+	}
+	if mismatches > 0 {
+		return fmt.Errorf("%d of %d rules have hashes that don't match", mismatches, len(labels))
+	}
+	fmt.Fprintf(os.Stderr, "Verified the hashes of %d rules\n", len(labels))
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, i := range ss {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOutput writes the output of a command to the file, or to stdout if the path is empty. The file is only replaced
+// once all the output has been written.
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "" {
+		return write(os.Stdout)
+	}
+	buf := new(bytes.Buffer)
+	if err := write(buf); err != nil {
+		return err
+	}
+	tx := journal.NewTransaction(runJournal)
+	tx.WriteFile(path, buf.Bytes(), 0644)
+	return tx.Commit()
+}
+
+// writeRules writes the rules back to the BUILD files, along with the rest of the repo's BUILD files that refer to any
+// rules that were renamed, or prints them, or a diff of them, to stdout. They're written in one transaction, so the
+// references are never left pointing at rules that don't exist.
+func writeRules(moduleGraph *rules.BuildGraph) error {
+	var tx *journal.Transaction
+	switch {
+	case opts.Write:
+		tx = journal.NewTransaction(runJournal)
+		moduleGraph.Stage(tx)
+	case opts.Diff:
+		if _, err := moduleGraph.Diff(os.Stdout); err != nil {
+			return err
+		}
+	default:
+		if err := moduleGraph.Write(false); err != nil {
+			return err
+		}
+	}
+
+	files, err := moduleGraph.UpdateFirstPartyDeps(".", opts.ThirdPartyFolder, tx)
+	if err != nil {
+		return err
+	}
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	verb := "Updated"
+	if !opts.Write {
+		verb = "Would update"
+	}
+	for _, f := range files {
+		fmt.Fprintf(os.Stderr, "%s %d renamed third party label(s) in %s\n", verb, f.Labels, f.Path)
+	}
+	return nil
+}
+
+// requirePlease returns an error if another backend is in use, for the parts of go-deps that only work with Please
+func requirePlease(feature string) error {
+	if opts.Backend != "please" {
+		return fmt.Errorf("%s is only supported by the please backend", feature)
+	}
+	return nil
+}
+
+// readRules reads the existing third party rules into a new build graph. Every BUILD file in the third party folder is
+// read, whichever layout they're in, and the layout is worked out from where the rules are. Modules defined in more than
+// one file are merged into one of them, so this is only used by the commands that write the rules.
+func readRules() (*rules.BuildGraph, bool, error) {
+	moduleGraph, structured, err := parseRules()
+	if err != nil {
+		return nil, false, err
+	}
+	mergeDuplicates(moduleGraph, structured)
+	return moduleGraph, structured, nil
+}
+
+// mergeDuplicates merges the modules that are defined more than once, warning about each one. This changes the rules,
+// so it should only be done by the commands that write them.
+func mergeDuplicates(moduleGraph *rules.BuildGraph, structured bool) {
+	if opts.Backend == "bazel" {
+		return
+	}
+	for _, d := range moduleGraph.MergeDuplicates(structured, opts.ThirdPartyFolder) {
+		fmt.Fprintf(os.Stderr, "Warning: %s is defined in more than one place. Replaced its rules in %s with aliases to the ones in %s.\n", d.Module, strings.Join(d.Removed, ", "), d.Kept)
+	}
+}
+
+// parseRules reads the existing third party rules as they are, without merging the modules that are defined more than
+// once. It also returns whether new rules should be written in the structured layout, which they are if the existing
+// rules are, or if we've been told to.
+func parseRules() (*rules.BuildGraph, bool, error) {
+	moduleGraph := rules.NewGraph(opts.BuildFileName)
+	moduleGraph.Journal = runJournal
+	if opts.Backend == "bazel" {
+		moduleGraph.Backend = &rules.BazelBackend{Path: opts.BazelDeps}
+		if err := moduleGraph.ReadRules(opts.BazelDeps); err != nil {
+			return nil, false, err
+		}
+		return moduleGraph, opts.Structured, nil
+	}
+
+	moduleGraph.GoRepo = opts.GoRepo
+	err := filepath.Walk(opts.ThirdPartyFolder, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			// There are no rules yet
+			if os.IsNotExist(err) && path == opts.ThirdPartyFolder {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if filepath.Base(path) == opts.BuildFileName {
+			if err := moduleGraph.ReadRules(path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	structured, mixed := moduleGraph.Layout(opts.ThirdPartyFolder)
+	if mixed {
+		fmt.Fprintf(os.Stderr, "Warning: the rules in %s are split between the flat and structured layouts. Run go-deps migrate --to=structured or --to=flat to move them into one.\n", opts.ThirdPartyFolder)
+	}
+	return moduleGraph, opts.Structured || structured, nil
+}
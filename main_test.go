@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/resolve"
+	"github.com/tatskaari/go-deps/rules"
+)
+
+// readTestRepo writes the files to a new repo, changes into it, and reads the third party rules in it with the default
+// options
+func readTestRepo(t *testing.T, files map[string]string) *rules.BuildGraph {
+	t.Helper()
+
+	dir := t.TempDir()
+	for path, contents := range files {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0775))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	}
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	oldOpts := opts
+	t.Cleanup(func() {
+		opts = oldOpts
+		os.Chdir(wd)
+	})
+	opts.ThirdPartyFolder = "third_party/go"
+	opts.BuildFileName = "BUILD"
+	opts.Backend = "please"
+
+	moduleGraph, _, err := parseRules()
+	require.NoError(t, err)
+	return moduleGraph
+}
+
+func modKey(path string) resolve.ModuleKey {
+	return resolve.ModuleKey{Path: path}
+}
+
+// testRules are the third party rules used by the tests. foo is installed with a wildcard, and bar depends on it.
+const testRules = `
+go_module(
+    name = "foo",
+    install = ["..."],
+    module = "example.com/foo",
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "bar",
+    module = "example.com/bar",
+    version = "v1.1.0",
+    deps = [":foo"],
+)
+
+go_module(
+    name = "baz",
+    install = ["x"],
+    module = "example.com/baz",
+    version = "v2.0.0",
+)
+`
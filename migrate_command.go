@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+)
+
+type migrateCommand struct {
+	To string `long:"to" required:"true" choice:"go_repo" choice:"structured" choice:"flat" description:"The kind of rules, or the layout, to migrate the third party rules to."`
+}
+
+// Execute converts the existing third party rules into another kind of rule, or moves them into another layout, without
+// changing any of the modules
+func (cmd *migrateCommand) Execute(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	if err := requirePlease("migrate"); err != nil {
+		return err
+	}
+
+	if cmd.To == "structured" || cmd.To == "flat" {
+		return migrateLayout(cmd.To == "structured")
+	}
+
+	moduleGraph, structured, err := readRules()
+	if err != nil {
+		return err
+	}
+
+	moduleGraph.MigrateToGoRepo()
+
+	if err := moduleGraph.Update(structured, opts.ThirdPartyFolder); err != nil {
+		return err
+	}
+	return writeRules(moduleGraph)
+}
+
+// migrateLayout moves the third party rules into the structured or flat layout
+func migrateLayout(structured bool) error {
+	moduleGraph, _, err := readRules()
+	if err != nil {
+		return err
+	}
+
+	if err := moduleGraph.MigrateLayout(structured, opts.ThirdPartyFolder); err != nil {
+		return err
+	}
+	return writeRules(moduleGraph)
+}
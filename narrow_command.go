@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/tatskaari/go-deps/resolve/knownimports"
+	"github.com/tatskaari/go-deps/resolve/model"
+	"github.com/tatskaari/go-deps/rules"
+	"github.com/tatskaari/go-deps/scan"
+)
+
+type narrowCommand struct{}
+
+// Execute narrows the wildcard installs of the modules passed in, or all modules if none are, down to the packages that
+// are actually used. The modules are pinned to their current versions.
+func (cmd *narrowCommand) Execute(args []string) error {
+	if err := requirePlease("narrow"); err != nil {
+		return err
+	}
+
+	moduleGraph, structured, err := readRules()
+	if err != nil {
+		return err
+	}
+
+	only := map[string]struct{}{}
+	for _, arg := range args {
+		only[arg] = struct{}{}
+	}
+
+	narrowed := map[*model.Module]struct{}{}
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if _, ok := only[m.Name]; len(only) > 0 && !ok {
+			continue
+		}
+		if !hasWildcards(m) {
+			continue
+		}
+		if m.ReplacedBy != "" {
+			fmt.Fprintf(os.Stderr, "Skipping %s as it's replaced by %s\n", m.Name, m.ReplacedBy)
+			continue
+		}
+		narrowed[m] = struct{}{}
+	}
+
+	getPaths, used, err := usedPackages(moduleGraph, narrowed)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if _, ok := narrowed[m]; !ok {
+			continue
+		}
+		if _, ok := used[m]; !ok && len(installedPackages(m)) == 0 {
+			fmt.Fprintf(os.Stderr, "Leaving %s as nothing imports its packages\n", m.Name)
+			delete(narrowed, m)
+			continue
+		}
+
+		// Remove the wildcards so only the packages we resolve are installed
+		for _, part := range m.Parts {
+			part.InstallWildCards = nil
+			part.Modified = true
+		}
+	}
+	if len(narrowed) == 0 {
+		fmt.Fprintln(os.Stderr, "No modules with wildcard installs to narrow")
+		return nil
+	}
+
+	if err := update(moduleGraph, structured, getPaths); err != nil {
+		return err
+	}
+
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if _, ok := narrowed[m]; ok {
+			fmt.Fprintf(os.Stderr, "Narrowed %s down to %d package(s)\n", m.Name, len(installedPackages(m)))
+		}
+	}
+	return nil
+}
+
+// usedPackages returns the packages to resolve to find which packages in the narrowed modules are needed. These are the
+// packages in those modules imported by first party code or installed explicitly, and the packages of any other module
+// that depends on them.
+// Each package is pinned to the current version of its module. The narrowed modules that are used by first party code,
+// or by other modules, are also returned.
+func usedPackages(moduleGraph *rules.BuildGraph, narrowed map[*model.Module]struct{}) ([]string, map[*model.Module]struct{}, error) {
+	var getPaths []string
+	done := map[string]struct{}{}
+	add := func(path, version string) {
+		if version != "" {
+			path += "@" + version
+		}
+		if _, ok := done[path]; !ok {
+			done[path] = struct{}{}
+			getPaths = append(getPaths, path)
+		}
+	}
+
+	imports, err := scan.Imports(".", opts.ThirdPartyFolder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	used := map[*model.Module]struct{}{}
+	modulePath := scan.ModulePath(".")
+	for _, i := range imports {
+		if knownimports.IsInGoRoot(i) || scan.IsFirstParty(i, modulePath) {
+			continue
+		}
+		part := moduleGraph.Modules.Provider(i)
+		if part == nil {
+			continue
+		}
+		if _, ok := narrowed[part.Module]; ok {
+			used[part.Module] = struct{}{}
+			add(i, part.Module.Version)
+		}
+	}
+
+	// The packages the narrowed modules install explicitly are kept, so we need to know what they import too
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if _, ok := narrowed[m]; ok {
+			for _, part := range m.Parts {
+				for _, pkg := range part.SortedPackages() {
+					add(pkg.ID, m.Version)
+				}
+			}
+		}
+	}
+
+	narrowedLabels := map[string]*model.Module{}
+	for label, part := range moduleGraph.PartsByLabel() {
+		if _, ok := narrowed[part.Module]; ok {
+			narrowedLabels[label] = part.Module
+		}
+	}
+
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if _, ok := narrowed[m]; ok {
+			continue
+		}
+		for _, part := range m.Parts {
+			deps, exportedDeps := moduleGraph.PartDeps(part)
+			dependsOnNarrowed := false
+			for _, dep := range append(deps, exportedDeps...) {
+				if dep, ok := narrowedLabels[dep]; ok {
+					used[dep] = struct{}{}
+					dependsOnNarrowed = true
+				}
+			}
+			if !dependsOnNarrowed {
+				continue
+			}
+			for _, pkg := range part.SortedPackages() {
+				add(pkg.ID, m.Version)
+			}
+			for _, i := range part.InstallWildCards {
+				add(filepath.Join(m.Name, i)+"/...", m.Version)
+			}
+		}
+	}
+	return getPaths, used, nil
+}
+
+func hasWildcards(m *model.Module) bool {
+	for _, part := range m.Parts {
+		if len(part.InstallWildCards) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// installedPackages returns the packages explicitly installed by the parts of the module
+func installedPackages(m *model.Module) map[*packages.Package]struct{} {
+	ret := map[*packages.Package]struct{}{}
+	for _, part := range m.Parts {
+		for pkg := range part.Packages {
+			ret[pkg] = struct{}{}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/tatskaari/go-deps/resolve/model"
+)
+
+func TestUsedPackages(t *testing.T) {
+	moduleGraph := readTestRepo(t, map[string]string{
+		"go.mod":                "module example.com/repo\n",
+		"src/main.go":           "package main\n\nimport (\n\t_ \"example.com/foo/a\"\n\t_ \"example.com/repo/lib\"\n)\n",
+		"third_party/go/BUILD":  testRules,
+		"third_party/go/foo.go": "package foo\n\nimport _ \"example.com/foo/ignored\"\n",
+	})
+	foo := moduleGraph.Modules.GetModule(modKey("example.com/foo"))
+	baz := moduleGraph.Modules.GetModule(modKey("example.com/baz"))
+
+	getPaths, used, err := usedPackages(moduleGraph, map[*model.Module]struct{}{foo: {}, baz: {}})
+	require.NoError(t, err)
+	// foo is imported by our code, and bar depends on it, so bar's packages are resolved too. Nothing uses baz, but the
+	// package it installs explicitly is kept.
+	require.Equal(t, []string{"example.com/foo/a@v1.0.0", "example.com/baz/x@v2.0.0", "example.com/bar@v1.1.0"}, getPaths)
+	require.Equal(t, map[*model.Module]struct{}{foo: {}}, used)
+}
+
+func TestHasWildcards(t *testing.T) {
+	moduleGraph := readTestRepo(t, map[string]string{"third_party/go/BUILD": testRules})
+
+	require.True(t, hasWildcards(moduleGraph.Modules.GetModule(modKey("example.com/foo"))))
+	require.False(t, hasWildcards(moduleGraph.Modules.GetModule(modKey("example.com/bar"))))
+}
+
+func TestInstalledPackages(t *testing.T) {
+	moduleGraph := readTestRepo(t, map[string]string{"third_party/go/BUILD": testRules})
+
+	require.Empty(t, installedPackages(moduleGraph.Modules.GetModule(modKey("example.com/foo"))))
+	require.Equal(t, []string{"example.com/baz/x"}, packageIDs(installedPackages(moduleGraph.Modules.GetModule(modKey("example.com/baz")))))
+}
+
+func packageIDs(pkgs map[*packages.Package]struct{}) []string {
+	var ret []string
+	for pkg := range pkgs {
+		ret = append(ret, pkg.ID)
+	}
+	return ret
+}
@@ -0,0 +1,184 @@
+// Package notices collects the licence and NOTICE texts of third party modules into a single attribution file, so they
+// can be shipped with the binaries that use them
+package notices
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tatskaari/go-deps/licence"
+)
+
+// Formats are the formats the notices can be written in
+var Formats = []string{"text", "markdown", "html"}
+
+// Text is the contents of a licence or NOTICE file in a module
+type Text struct {
+	// Path is the path to the file, relative to the root of the module
+	Path    string
+	Content string
+}
+
+// Module is the licence and NOTICE texts for a module
+type Module struct {
+	Path    string
+	Version string
+	// Licence is the SPDX expression for the module's licences
+	Licence  string
+	Licences []Text
+	Notices  []Text
+}
+
+// Header returns the module@version header for the module
+func (m *Module) Header() string {
+	if m.Version == "" {
+		return m.Path
+	}
+	return m.Path + "@" + m.Version
+}
+
+// Collect reads the texts of the licence and NOTICE files the detector finds in the module, which has been downloaded
+// to dir. If licences is empty, the licence is the one the detector works out.
+func Collect(detector *licence.Detector, path, version, licences, dir string) (*Module, error) {
+	detection, err := detector.Detect(path, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the licences of %s: %v", path, err)
+	}
+	if licences == "" {
+		licences = detection.Licence
+	}
+
+	m := &Module{Path: path, Version: version, Licence: licences}
+	for _, f := range detection.Files {
+		text, err := readText(dir, f.Path)
+		if err != nil {
+			return nil, err
+		}
+		m.Licences = append(m.Licences, text)
+	}
+	for _, f := range detection.Notices {
+		text, err := readText(dir, f)
+		if err != nil {
+			return nil, err
+		}
+		m.Notices = append(m.Notices, text)
+	}
+	return m, nil
+}
+
+func readText(dir, path string) (Text, error) {
+	data, err := os.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return Text{}, err
+	}
+	return Text{Path: filepath.ToSlash(path), Content: strings.TrimRight(string(data), "\n") + "\n"}, nil
+}
+
+// Write writes the notices for the modules in the format, which is one of Formats
+func Write(w io.Writer, format string, mods []*Module) error {
+	switch format {
+	case "text":
+		return writeText(w, mods)
+	case "markdown":
+		return writeMarkdown(w, mods)
+	case "html":
+		return htmlTemplate.Execute(w, mods)
+	}
+	return fmt.Errorf("unknown notices format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+func writeText(w io.Writer, mods []*Module) error {
+	rule := strings.Repeat("=", 80)
+	p := &printer{w: w}
+	p.printf("Third party notices\n")
+	for _, m := range mods {
+		p.printf("\n%s\n%s\n", rule, m.Header())
+		if m.Licence != "" {
+			p.printf("Licence: %s\n", m.Licence)
+		}
+		p.printf("%s\n", rule)
+		for _, t := range append(append([]Text{}, m.Licences...), m.Notices...) {
+			p.printf("\n--- %s ---\n\n%s", t.Path, t.Content)
+		}
+	}
+	return p.err
+}
+
+func writeMarkdown(w io.Writer, mods []*Module) error {
+	p := &printer{w: w}
+	p.printf("# Third party notices\n")
+	for _, m := range mods {
+		p.printf("\n## %s\n", m.Header())
+		if m.Licence != "" {
+			p.printf("\nLicence: %s\n", m.Licence)
+		}
+		for _, t := range append(append([]Text{}, m.Licences...), m.Notices...) {
+			fence := codeFence(t.Content)
+			p.printf("\n### %s\n\n%s\n%s%s\n", t.Path, fence, t.Content, fence)
+		}
+	}
+	return p.err
+}
+
+// codeFence returns a fence for a Markdown code block that's longer than any run of backticks in the content, so the
+// content can't close the block early
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+var htmlTemplate = template.Must(template.New("notices").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Third party notices</title>
+</head>
+<body>
+<h1>Third party notices</h1>
+{{- range . }}
+<h2>{{ .Header }}</h2>
+{{- if .Licence }}
+<p>Licence: {{ .Licence }}</p>
+{{- end }}
+{{- range .Licences }}
+<h3>{{ .Path }}</h3>
+<pre>{{ .Content }}</pre>
+{{- end }}
+{{- range .Notices }}
+<h3>{{ .Path }}</h3>
+<pre>{{ .Content }}</pre>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
+
+// printer writes formatted output, keeping the first error so it can be checked once at the end
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = fmt.Fprintf(p.w, format, args...)
+}
@@ -0,0 +1,88 @@
+package notices
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/licence"
+)
+
+func TestCollect(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "LICENSE"), []byte("Do what you like\n\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "NOTICE"), []byte("Copyright example.com"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+
+	d, err := licence.NewDetector(licence.DefaultThreshold, nil)
+	require.NoError(t, err)
+	m, err := Collect(d, "example.com/foo", "v1.0.0", "MIT", dir)
+	require.NoError(t, err)
+	require.Equal(t, &Module{
+		Path:     "example.com/foo",
+		Version:  "v1.0.0",
+		Licence:  "MIT",
+		Licences: []Text{{Path: "LICENSE", Content: "Do what you like\n"}},
+		Notices:  []Text{{Path: "NOTICE", Content: "Copyright example.com\n"}},
+	}, m)
+}
+
+var testModules = []*Module{
+	{
+		Path:     "example.com/foo",
+		Version:  "v1.0.0",
+		Licence:  "MIT",
+		Licences: []Text{{Path: "LICENSE", Content: "Use it <freely>\n```\n"}},
+		Notices:  []Text{{Path: "NOTICE", Content: "Copyright example.com\n"}},
+	},
+	{
+		Path: "example.com/bar",
+	},
+}
+
+func TestWriteText(t *testing.T) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, Write(buf, "text", testModules))
+	require.Equal(t, `Third party notices
+
+================================================================================
+example.com/foo@v1.0.0
+Licence: MIT
+================================================================================
+
+--- LICENSE ---
+
+Use it <freely>
+`+"```"+`
+
+--- NOTICE ---
+
+Copyright example.com
+
+================================================================================
+example.com/bar
+================================================================================
+`, buf.String())
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, Write(buf, "markdown", testModules[:1]))
+	require.Equal(t, "# Third party notices\n\n"+
+		"## example.com/foo@v1.0.0\n\n"+
+		"Licence: MIT\n\n"+
+		"### LICENSE\n\n````\nUse it <freely>\n```\n````\n\n"+
+		"### NOTICE\n\n```\nCopyright example.com\n```\n", buf.String())
+}
+
+func TestWriteHTML(t *testing.T) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, Write(buf, "html", testModules[:1]))
+	require.Contains(t, buf.String(), "<h2>example.com/foo@v1.0.0</h2>")
+	require.Contains(t, buf.String(), "<pre>Use it &lt;freely&gt;\n```\n</pre>")
+
+	require.Error(t, Write(buf, "pdf", testModules))
+}
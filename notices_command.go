@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tatskaari/go-deps/config"
+	"github.com/tatskaari/go-deps/graph"
+	"github.com/tatskaari/go-deps/licence"
+	"github.com/tatskaari/go-deps/notices"
+	"github.com/tatskaari/go-deps/please"
+	"github.com/tatskaari/go-deps/progress"
+	"github.com/tatskaari/go-deps/resolve/driver"
+	"github.com/tatskaari/go-deps/resolve/model"
+	"github.com/tatskaari/go-deps/rules"
+	"github.com/tatskaari/go-deps/scan"
+)
+
+type noticesCommand struct {
+	Format string `long:"format" short:"f" default:"text" choice:"text" choice:"markdown" choice:"html" description:"The format to write the notices in."`
+	Out    string `long:"out" short:"o" description:"The file to write the notices to. Printed to stdout by default."`
+	Rule   string `long:"rule" description:"Adds a filegroup() with this name, that provides the notices file, to the BUILD file next to it. Requires --out."`
+}
+
+// Execute collects the licence and NOTICE texts of the third party modules. The args are build labels or module paths,
+// and if any are passed, only the modules they depend on are included.
+func (cmd *noticesCommand) Execute(args []string) error {
+	if cmd.Rule != "" && cmd.Out == "" {
+		return fmt.Errorf("--rule needs the notices to be written to a file with --out")
+	}
+
+	moduleGraph, _, err := parseRules()
+	if err != nil {
+		return err
+	}
+	defer progress.Clear()
+	mods, err := reachableModules(moduleGraph, args)
+	if err != nil {
+		return err
+	}
+
+	c, err := config.ReadRepo(".")
+	if err != nil {
+		return err
+	}
+	detector, err := licence.LoadDetector(c)
+	if err != nil {
+		return err
+	}
+
+	modulePath := scan.ModulePath(".")
+	var ret []*notices.Module
+	for _, m := range mods {
+		if scan.IsFirstParty(m.Name, modulePath) {
+			continue
+		}
+		dir, err := moduleSource(m)
+		if err != nil {
+			return err
+		}
+		n, err := notices.Collect(detector, m.Name, m.Version, licence.Or(moduleGraph.Licences(m)...), dir)
+		if err != nil {
+			return err
+		}
+		if len(n.Licences) == 0 {
+			progress.Clear()
+			fmt.Fprintf(os.Stderr, "Warning: couldn't find a licence file in %s\n", n.Header())
+		}
+		ret = append(ret, n)
+	}
+
+	err = writeOutput(cmd.Out, func(w io.Writer) error {
+		return notices.Write(w, cmd.Format, ret)
+	})
+	if err != nil {
+		return err
+	}
+
+	if cmd.Rule != "" {
+		buildFile := filepath.Join(filepath.Dir(cmd.Out), opts.BuildFileName)
+		if err := rules.SetFilegroup(runJournal, buildFile, cmd.Rule, filepath.Base(cmd.Out)); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Added :%s to %s\n", cmd.Rule, buildFile)
+	}
+	return nil
+}
+
+// reachableModules returns the modules the targets depend on, sorted by path. The targets are either module paths, or
+// build labels, which we ask Please for the deps of. If there are no targets, all the modules are returned.
+func reachableModules(moduleGraph *rules.BuildGraph, targets []string) ([]*model.Module, error) {
+	if len(targets) == 0 {
+		return moduleGraph.Modules.SortedMods(), nil
+	}
+
+	var modules, labels []string
+	for _, t := range targets {
+		if strings.HasPrefix(t, "//") || strings.HasPrefix(t, ":") {
+			labels = append(labels, t)
+		} else {
+			modules = append(modules, t)
+		}
+	}
+	if len(labels) > 0 {
+		if err := requirePlease("finding the modules a build label depends on"); err != nil {
+			return nil, err
+		}
+		deps, err := please.Deps(opts.PleaseTool, labels...)
+		if err != nil {
+			return nil, err
+		}
+		parts := moduleGraph.PartsByLabel()
+		for _, dep := range deps {
+			if part, ok := parts[dep]; ok {
+				modules = append(modules, part.Module.Name)
+			}
+		}
+	}
+
+	keep := map[string]struct{}{}
+	for _, n := range graph.Build(moduleGraph).Reachable(modules...).Nodes {
+		if n.Kind == graph.ModuleNode {
+			keep[n.Name] = struct{}{}
+		}
+	}
+	var ret []*model.Module
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if _, ok := keep[m.Name]; ok {
+			ret = append(ret, m)
+		}
+	}
+	return ret, nil
+}
+
+// moduleSource returns the directory containing the module's source, downloading it if needed. Modules replaced by a
+// local directory are read from there.
+func moduleSource(m *model.Module) (string, error) {
+	path := m.Name
+	if m.ReplacedBy != "" {
+		if strings.HasPrefix(m.ReplacedBy, ".") || filepath.IsAbs(m.ReplacedBy) {
+			return m.ReplacedBy, nil
+		}
+		path = m.ReplacedBy
+	}
+	if m.Version == "" {
+		return "", fmt.Errorf("can't download %s to find its licence as it doesn't have a version", m.Name)
+	}
+	return driver.Download(opts.GoTool, path, m.Version)
+}
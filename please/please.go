@@ -0,0 +1,94 @@
+// Package please runs Please to find out things about the build graph that we can't work out from the BUILD files alone
+package please
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/tatskaari/go-deps/progress"
+)
+
+// Hash runs `plz hash` to compute the hashes of the outputs of the targets, as Please would expect them in the hashes
+// attribute of the rule. This builds the targets, but doesn't check any hashes they already have. Returns the hashes
+// keyed by the label of the target.
+func Hash(pleaseTool string, labels ...string) (map[string]string, error) {
+	if len(labels) == 0 {
+		return map[string]string{}, nil
+	}
+
+	progress.PrintUpdate("Hashing %d target(s)...", len(labels))
+	defer progress.Clear()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd := exec.Command(pleaseTool, append([]string{"hash"}, labels...)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to hash %v: %v\n%v", labels, err, stderr)
+	}
+	return parseHashes(stdout.String(), labels)
+}
+
+// parseHashes parses the output of `plz hash`. This is a line for each target in the form `//label: hash`, or just the
+// hash if there's only one target.
+func parseHashes(out string, labels []string) (map[string]string, error) {
+	ret := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if i := strings.LastIndex(line, ": "); i >= 0 {
+			ret[line[:i]] = strings.TrimSpace(line[i+2:])
+		} else if len(labels) == 1 {
+			ret[labels[0]] = line
+		} else {
+			return nil, fmt.Errorf("unexpected output from plz hash: %v", line)
+		}
+	}
+
+	for _, label := range labels {
+		if _, ok := ret[label]; !ok {
+			return nil, fmt.Errorf("plz hash didn't return a hash for %v", label)
+		}
+	}
+	return ret, nil
+}
+
+// Deps runs `plz query deps` to find the labels of all the targets the given targets transitively depend on, including
+// the targets themselves
+func Deps(pleaseTool string, labels ...string) ([]string, error) {
+	progress.PrintUpdate("Querying the deps of %d target(s)...", len(labels))
+	defer progress.Clear()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd := exec.Command(pleaseTool, append([]string{"query", "deps", "--unique"}, labels...)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to query the deps of %v: %v\n%v", labels, err, stderr)
+	}
+	return parseDeps(stdout.String()), nil
+}
+
+// parseDeps parses the output of `plz query deps`. This is a label per line, possibly indented.
+func parseDeps(out string) []string {
+	var ret []string
+	seen := map[string]struct{}{}
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		label := strings.TrimSpace(scanner.Text())
+		if label == "" {
+			continue
+		}
+		if _, ok := seen[label]; !ok {
+			seen[label] = struct{}{}
+			ret = append(ret, label)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,31 @@
+package please
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHashes(t *testing.T) {
+	hashes, err := parseHashes("//third_party/go:foo_dl: 2d4a1c\n//third_party/go:bar: 9f8e7d\n", []string{"//third_party/go:foo_dl", "//third_party/go:bar"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"//third_party/go:foo_dl": "2d4a1c",
+		"//third_party/go:bar":    "9f8e7d",
+	}, hashes)
+
+	hashes, err = parseHashes("2d4a1c\n", []string{"//third_party/go:foo_dl"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"//third_party/go:foo_dl": "2d4a1c"}, hashes)
+
+	_, err = parseHashes("//third_party/go:foo_dl: 2d4a1c\n", []string{"//third_party/go:foo_dl", "//third_party/go:bar"})
+	require.Error(t, err)
+}
+
+func TestParseDeps(t *testing.T) {
+	require.Equal(t, []string{
+		"//cmd:server",
+		"//third_party/go:foo",
+		"//third_party/go:bar",
+	}, parseDeps("//cmd:server\n  //third_party/go:foo\n    //third_party/go:bar\n  //third_party/go:bar\n\n"))
+}
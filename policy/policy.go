@@ -0,0 +1,161 @@
+// Package policy restricts which third party modules can be used: modules can be banned, the hosts modules come from
+// can be limited to an allowlist, and modules can be given a minimum version
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/tatskaari/go-deps/config"
+)
+
+// Floor is the minimum version of a module that's allowed
+type Floor struct {
+	Version string
+	// Reason is why earlier versions aren't allowed
+	Reason string
+}
+
+// Policy is the modules that are allowed in the repo. It's read from the .godepsconfig:
+//
+//	[modulepolicy]
+//	allowedhost = github.com
+//	allowedhost = golang.org
+//
+//	[bannedmodule "github.com/golang/protobuf"]
+//	reason = Use google.golang.org/protobuf instead
+//
+//	[minimumversion "golang.org/x/crypto"]
+//	version = v0.17.0
+//	reason = Earlier versions are vulnerable to CVE-2023-48795
+type Policy struct {
+	// AllowedHosts are the hosts modules can come from. Subdomains of them are allowed too. If this is empty, modules can
+	// come from anywhere.
+	AllowedHosts []string
+	// Banned are the modules that can't be used, mapped to the reason they're banned. Modules nested inside them are
+	// banned too.
+	Banned map[string]string
+	// Floors are the minimum versions of modules
+	Floors map[string]Floor
+}
+
+// New creates the module policy from the config. Banned modules must have a reason, and minimum versions must be valid
+// semantic versions.
+func New(c config.Config) (*Policy, error) {
+	p := &Policy{
+		AllowedHosts: c.Get("modulepolicy", "allowedhost"),
+		Banned:       map[string]string{},
+		Floors:       map[string]Floor{},
+	}
+	for _, module := range c.Subsections("bannedmodule") {
+		reason := c.GetString(fmt.Sprintf("bannedmodule %q", module), "reason")
+		if reason == "" {
+			return nil, fmt.Errorf("the banned module %s in %s must have a reason", module, config.FileName)
+		}
+		p.Banned[module] = reason
+	}
+	for _, module := range c.Subsections("minimumversion") {
+		section := fmt.Sprintf("minimumversion %q", module)
+		version := c.GetString(section, "version")
+		if !semver.IsValid(version) {
+			return nil, fmt.Errorf("the minimum version of %s in %s must be a semantic version e.g. v1.2.3, not %q", module, config.FileName, version)
+		}
+		p.Floors[module] = Floor{Version: version, Reason: c.GetString(section, "reason")}
+	}
+	return p, nil
+}
+
+// IsEmpty returns true if the policy doesn't restrict any modules
+func (p *Policy) IsEmpty() bool {
+	return p == nil || (len(p.AllowedHosts) == 0 && len(p.Banned) == 0 && len(p.Floors) == 0)
+}
+
+// Violation is a module that isn't allowed by the policy
+type Violation struct {
+	Module  string
+	Version string
+	Reason  string
+	// Chain is the packages, or modules, that pulled the module in, starting with the one that was asked for
+	Chain []string
+}
+
+func (v *Violation) Error() string {
+	module := v.Module
+	if v.Version != "" {
+		module += "@" + v.Version
+	}
+	ret := fmt.Sprintf("%s isn't allowed: %s", module, v.Reason)
+	if len(v.Chain) > 0 {
+		ret += fmt.Sprintf("\n  pulled in by %s", strings.Join(v.Chain, " -> "))
+	}
+	return ret
+}
+
+// CheckHost checks the host of an import path, or module path, is allowed. This can be done before we know which module
+// the package is in, so we don't download anything from hosts that aren't allowed.
+func (p *Policy) CheckHost(path string) *Violation {
+	if p.IsEmpty() || len(p.AllowedHosts) == 0 {
+		return nil
+	}
+	host := strings.SplitN(path, "/", 2)[0]
+	for _, allowed := range p.AllowedHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return &Violation{Module: path, Reason: fmt.Sprintf("%s isn't one of the allowed hosts", host)}
+}
+
+// Check checks the version of the module is allowed. The version can be empty if it's not known yet, in which case only
+// the host and bans are checked.
+func (p *Policy) Check(module, version string) *Violation {
+	if p.IsEmpty() {
+		return nil
+	}
+	if v := p.CheckHost(module); v != nil {
+		v.Version = version
+		return v
+	}
+
+	for _, banned := range sortedKeys(p.Banned) {
+		if module == banned || strings.HasPrefix(module, banned+"/") {
+			return &Violation{Module: module, Version: version, Reason: fmt.Sprintf("%s is banned: %s", banned, p.Banned[banned])}
+		}
+	}
+
+	if floor, ok := p.Floors[module]; ok && version != "" && semver.Compare(version, floor.Version) < 0 {
+		reason := fmt.Sprintf("the minimum version is %s", floor.Version)
+		if floor.Reason != "" {
+			reason += ": " + floor.Reason
+		}
+		return &Violation{Module: module, Version: version, Reason: reason}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of the map in order, so the first matching ban is always reported
+func sortedKeys(m map[string]string) []string {
+	ret := make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Error is returned when modules aren't allowed by the policy
+type Error struct {
+	Violations []*Violation
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, 0, len(e.Violations)+1)
+	lines = append(lines, fmt.Sprintf("%d module(s) aren't allowed by the module policy in %s:", len(e.Violations), config.FileName))
+	for _, v := range e.Violations {
+		lines = append(lines, "  "+strings.ReplaceAll(v.Error(), "\n", "\n  "))
+	}
+	return strings.Join(lines, "\n")
+}
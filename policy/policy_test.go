@@ -0,0 +1,63 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/config"
+)
+
+func TestCheck(t *testing.T) {
+	p, err := New(config.Config{
+		"modulepolicy": {
+			"allowedhost": {"github.com", "golang.org"},
+		},
+		`bannedmodule "github.com/golang/protobuf"`: {
+			"reason": {"Use google.golang.org/protobuf instead"},
+		},
+		`minimumversion "golang.org/x/crypto"`: {
+			"version": {"v0.17.0"},
+			"reason":  {"Earlier versions are vulnerable to CVE-2023-48795"},
+		},
+	})
+	require.NoError(t, err)
+
+	require.Nil(t, p.Check("github.com/stretchr/testify", "v1.8.0"))
+	require.Nil(t, p.Check("golang.org/x/crypto", "v0.17.0"))
+	require.Nil(t, p.Check("golang.org/x/crypto", ""))
+
+	// Subdomains of the allowed hosts are allowed too
+	require.Nil(t, p.CheckHost("go.golang.org/foo"))
+	require.Equal(t, "gopkg.in isn't one of the allowed hosts", p.CheckHost("gopkg.in/yaml.v3").Reason)
+	require.Equal(t, "evilgithub.com isn't one of the allowed hosts", p.Check("evilgithub.com/foo", "v1.0.0").Reason)
+
+	// Modules nested inside a banned module are banned too
+	require.Equal(t, "github.com/golang/protobuf is banned: Use google.golang.org/protobuf instead", p.Check("github.com/golang/protobuf", "v1.5.0").Reason)
+	require.NotNil(t, p.Check("github.com/golang/protobuf/v2", "v2.0.0"))
+	require.Nil(t, p.Check("github.com/golang/protobufs", "v1.0.0"))
+
+	v := p.Check("golang.org/x/crypto", "v0.16.0")
+	v.Chain = []string{"example.com/app", "golang.org/x/crypto/ssh"}
+	require.Equal(t, "golang.org/x/crypto@v0.16.0 isn't allowed: the minimum version is v0.17.0: Earlier versions are vulnerable to CVE-2023-48795\n"+
+		"  pulled in by example.com/app -> golang.org/x/crypto/ssh", v.Error())
+}
+
+func TestEmptyPolicyAllowsEverything(t *testing.T) {
+	p, err := New(config.Config{})
+	require.NoError(t, err)
+	require.True(t, p.IsEmpty())
+	require.Nil(t, p.Check("gopkg.in/yaml.v3", "v3.0.0"))
+
+	var nilPolicy *Policy
+	require.Nil(t, nilPolicy.Check("gopkg.in/yaml.v3", "v3.0.0"))
+	require.Nil(t, nilPolicy.CheckHost("gopkg.in/yaml.v3"))
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	_, err := New(config.Config{`bannedmodule "github.com/golang/protobuf"`: {}})
+	require.Error(t, err)
+
+	_, err = New(config.Config{`minimumversion "golang.org/x/crypto"`: {"version": {"0.17"}}})
+	require.Error(t, err)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tatskaari/go-deps/config"
+	"github.com/tatskaari/go-deps/graph"
+	"github.com/tatskaari/go-deps/policy"
+	"github.com/tatskaari/go-deps/rules"
+	"github.com/tatskaari/go-deps/scan"
+)
+
+type policyCommand struct {
+	Check policyCheckCommand `command:"check" description:"Checks the existing third party rules against the module policy, failing if any modules aren't allowed. This is intended to be run in CI."`
+}
+
+type policyCheckCommand struct{}
+
+// Execute checks every third party module against the module policy, listing the ones that aren't allowed along with
+// the modules that require them
+func (cmd *policyCheckCommand) Execute(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	c, err := config.ReadRepo(".")
+	if err != nil {
+		return err
+	}
+	modulePolicy, err := policy.New(c)
+	if err != nil {
+		return err
+	}
+	if modulePolicy.IsEmpty() {
+		fmt.Fprintf(os.Stderr, "No module policy is set in %s\n", config.FileName)
+		return nil
+	}
+
+	moduleGraph, _, err := parseRules()
+	if err != nil {
+		return err
+	}
+
+	chains := requiredBy(moduleGraph)
+	modulePath := scan.ModulePath(".")
+	var violations []*policy.Violation
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if scan.IsFirstParty(m.Name, modulePath) {
+			continue
+		}
+		var v *policy.Violation
+		if m.ReplacedBy != "" && !strings.HasPrefix(m.ReplacedBy, ".") && !strings.HasPrefix(m.ReplacedBy, "/") {
+			// The version is the version of the module that replaces this one
+			if v = modulePolicy.Check(m.Name, ""); v == nil {
+				v = modulePolicy.Check(m.ReplacedBy, m.Version)
+			}
+		} else {
+			v = modulePolicy.Check(m.Name, m.Version)
+		}
+		if v != nil {
+			v.Chain = chains[m.Name]
+			violations = append(violations, v)
+		}
+	}
+
+	if len(violations) > 0 {
+		return &policy.Error{Violations: violations}
+	}
+	fmt.Fprintln(os.Stderr, "All modules are allowed by the module policy")
+	return nil
+}
+
+// requiredBy finds the shortest chain of modules that requires each module, starting from a module nothing else
+// depends on. Modules nothing depends on aren't in the map.
+func requiredBy(moduleGraph *rules.BuildGraph) map[string][]string {
+	g := graph.Build(moduleGraph)
+	deps := map[string][]string{}
+	depended := map[string]struct{}{}
+	for _, e := range g.Edges {
+		if e.Kind != graph.ModuleDepEdge {
+			continue
+		}
+		from, to := g.Node(e.From).Name, g.Node(e.To).Name
+		deps[from] = append(deps[from], to)
+		depended[to] = struct{}{}
+	}
+
+	parents := map[string]string{}
+	var queue []string
+	for _, m := range moduleGraph.Modules.SortedMods() {
+		if _, ok := depended[m.Name]; !ok {
+			parents[m.Name] = ""
+			queue = append(queue, m.Name)
+		}
+	}
+	for len(queue) > 0 {
+		m := queue[0]
+		queue = queue[1:]
+		sort.Strings(deps[m])
+		for _, dep := range deps[m] {
+			if _, ok := parents[dep]; !ok {
+				parents[dep] = m
+				queue = append(queue, dep)
+			}
+		}
+	}
+
+	ret := map[string][]string{}
+	for m, parent := range parents {
+		if parent == "" {
+			continue
+		}
+		chain := []string{m}
+		for ; parent != ""; parent = parents[parent] {
+			chain = append([]string{parent}, chain...)
+		}
+		ret[m] = chain
+	}
+	return ret
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredBy(t *testing.T) {
+	moduleGraph := readTestRepo(t, map[string]string{
+		"third_party/go/BUILD": testRules + `
+go_module(
+    name = "qux",
+    module = "example.com/qux",
+    version = "v0.1.0",
+    deps = [":bar"],
+)
+`,
+	})
+
+	// Modules that nothing depends on aren't pulled in by anything
+	require.Equal(t, map[string][]string{
+		"example.com/bar": {"example.com/qux", "example.com/bar"},
+		"example.com/foo": {"example.com/qux", "example.com/bar", "example.com/foo"},
+	}, requiredBy(moduleGraph))
+}
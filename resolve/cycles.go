@@ -0,0 +1,46 @@
+package resolve
+
+// WalkCycles finds the cycles in a graph by walking it depth first from each of the nodes in order, so the same cycles
+// are found each time. Nodes must be comparable, and deps returns the nodes that a node has edges to. found is called
+// with each cycle found, which starts and ends with the same node, and the walk stops if it returns false. One cycle is
+// found for each edge back to a node that's still being walked, so not every cycle through a node is reported.
+func WalkCycles(nodes []interface{}, deps func(node interface{}) []interface{}, found func(cycle []interface{}) bool) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[interface{}]int{}
+	var stack []interface{}
+
+	var visit func(node interface{}) bool
+	visit = func(node interface{}) bool {
+		state[node] = visiting
+		stack = append(stack, node)
+		for _, dep := range deps(node) {
+			switch state[dep] {
+			case visiting:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == dep {
+						if !found(append(append([]interface{}{}, stack[i:]...), dep)) {
+							return false
+						}
+						break
+					}
+				}
+			case 0:
+				if !visit(dep) {
+					return false
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[node] = visited
+		return true
+	}
+
+	for _, node := range nodes {
+		if state[node] == 0 && !visit(node) {
+			return
+		}
+	}
+}
@@ -49,10 +49,27 @@ func (driver *pleaseDriver) ensureDownloaded(mod *packages.Module) (srcRoot stri
 		return target.srcRoot, nil
 	}
 
+	dir, err := Download(driver.goTool, mod.Path, mod.Version)
+	if err != nil {
+		return "", err
+	}
+	driver.downloaded[key] = dir
+	return dir, nil
+}
+
+// Download downloads the module with `go mod download`, returning the directory it was downloaded to. This is done in
+// plz-out/godeps, with its own go.mod and GOPATH, so the main repo isn't touched.
+func Download(goTool, path, version string) (string, error) {
+	key := fmt.Sprintf("%v@%v", path, version)
+
+	if err := os.MkdirAll("plz-out/godeps", dirPerms); err != nil && !os.IsExist(err) {
+		return "", err
+	}
+
 	// Create a dummy go.mod to avoid us accidentally updating the main repo
 	if _, err := os.Lstat("plz-out/godeps/go.mod"); err != nil {
 		if os.IsNotExist(err) {
-			cmd := exec.Command(driver.goTool, "mod", "init", "dummy")
+			cmd := exec.Command(goTool, "mod", "init", "dummy")
 			cmd.Dir = "plz-out/godeps"
 			out, err := cmd.CombinedOutput()
 			if err != nil {
@@ -77,7 +94,7 @@ func (driver *pleaseDriver) ensureDownloaded(mod *packages.Module) (srcRoot stri
 	}
 
 	// Downlaod using `go mod download`
-	cmd := exec.Command(driver.goTool, "mod", "download", "--json", key)
+	cmd := exec.Command(goTool, "mod", "download", "--json", key)
 	if goroot := os.Getenv("GOROOT"); goroot != "" {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("GOROOT=%s", goroot))
 	}
@@ -102,8 +119,6 @@ func (driver *pleaseDriver) ensureDownloaded(mod *packages.Module) (srcRoot stri
 		return "", err
 	}
 
-	driver.downloaded[key] = resp.Dir
-
 	return resp.Dir, nil
 }
 
@@ -2,6 +2,7 @@ package driver
 
 import (
 	"fmt"
+	"github.com/tatskaari/go-deps/policy"
 	"github.com/tatskaari/go-deps/progress"
 	"github.com/tatskaari/go-deps/resolve/driver/proxy"
 	"go/build"
@@ -11,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"golang.org/x/tools/go/packages"
@@ -39,6 +41,11 @@ type pleaseDriver struct {
 	packages map[string]*packages.Package
 
 	downloaded map[string]string
+
+	// policy is checked before each module is downloaded, so we never fetch modules that aren't allowed. Packages in
+	// modules that aren't allowed are returned without any files, so the resolver can report every violation along with
+	// the imports that pulled it in.
+	policy *policy.Policy
 }
 
 type packageInfo struct {
@@ -46,9 +53,11 @@ type packageInfo struct {
 	srcRoot, pkgDir string
 	mod             *requirement
 	isSDKPackage    bool
+	// disallowed is set when the module isn't allowed by the policy, in which case it isn't downloaded
+	disallowed bool
 }
 
-func NewPleaseDriver(please, goTool, thirdPartyFolder string) *pleaseDriver {
+func NewPleaseDriver(please, goTool, thirdPartyFolder string, modulePolicy *policy.Policy) *pleaseDriver {
 	//TODO(jpoole): split this on , and get rid of direct
 	proxyURL := os.Getenv("GOPROXY")
 	if proxyURL == "" {
@@ -62,6 +71,7 @@ func NewPleaseDriver(please, goTool, thirdPartyFolder string) *pleaseDriver {
 		proxy:            proxy.New(proxyURL),
 		downloaded:       map[string]string{},
 		pleaseModules:    map[string]*goModDownloadRule{},
+		policy:           modulePolicy,
 	}
 }
 
@@ -75,11 +85,19 @@ func (driver *pleaseDriver) pkgInfo(from *requirement, id string) (*packageInfo,
 		return info, err
 	}
 
+	if v := driver.policy.CheckHost(id); v != nil {
+		return disallowed(id, &packages.Module{Path: id}), nil
+	}
+
 	mod, err := driver.ModuleForPackage(id)
 	if err != nil {
 		return nil, fmt.Errorf("no module requirement for %v", err)
 	}
 
+	if v := driver.policy.Check(mod.mod.Path, mod.mod.Version); v != nil {
+		return disallowed(id, mod.mod), nil
+	}
+
 	srcRoot, err := driver.ensureDownloaded(mod.mod)
 	if err != nil {
 		return nil, err
@@ -94,6 +112,11 @@ func (driver *pleaseDriver) pkgInfo(from *requirement, id string) (*packageInfo,
 	}, nil
 }
 
+// disallowed returns the info for a package in a module that isn't allowed by the policy
+func disallowed(id string, mod *packages.Module) *packageInfo {
+	return &packageInfo{id: id, mod: &requirement{mod: mod}, disallowed: true}
+}
+
 func (driver *pleaseDriver) checkReplace(from *requirement, id string) (*packageInfo, error) {
 	if from == nil {
 		return nil, nil
@@ -104,6 +127,9 @@ func (driver *pleaseDriver) checkReplace(from *requirement, id string) (*package
 			ver := req.New
 
 			mod := driver.moduleRequirements[ver.Path]
+			if v := driver.policy.Check(ver.Path, ver.Version); v != nil {
+				return disallowed(id, &packages.Module{Path: req.Old.Path, Version: req.Old.Version, Replace: &packages.Module{Path: ver.Path, Version: ver.Version}}), nil
+			}
 
 			srcRoot, err := driver.ensureDownloaded(mod.mod)
 			if err != nil {
@@ -152,7 +178,7 @@ func (driver *pleaseDriver) loadPattern(pattern string) ([]string, error) {
 		return nil, err
 	}
 
-	if walk {
+	if walk && !info.disallowed {
 		var roots []string
 
 		err := filepath.Walk(info.pkgDir, func(path string, i fs.FileInfo, err error) error {
@@ -198,6 +224,11 @@ func (driver *pleaseDriver) loadPackage(info *packageInfo) error {
 		return nil
 	}
 
+	if info.disallowed {
+		driver.packages[info.id] = &packages.Package{ID: info.id, PkgPath: info.id, Module: info.mod.mod}
+		return nil
+	}
+
 	progress.PrintUpdate("Analysing %v", info.id)
 	pkg, err := build.ImportDir(info.pkgDir, build.ImportComment)
 	if err != nil {
@@ -270,5 +301,8 @@ func (driver *pleaseDriver) Resolve(cfg *packages.Config, patterns ...string) (*
 	for _, pkg := range driver.packages {
 		resp.Packages = append(resp.Packages, pkg)
 	}
+	sort.Slice(resp.Packages, func(i, j int) bool {
+		return resp.Packages[i].ID < resp.Packages[j].ID
+	})
 	return resp, nil
 }
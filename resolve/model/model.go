@@ -3,6 +3,7 @@ package model
 import (
 	"golang.org/x/tools/go/packages"
 	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -12,7 +13,8 @@ type Module struct {
 	Name       string
 	ReplacedBy string
 	Version    string
-	Licence    string
+	// The SPDX expression for the module's licences e.g. MIT OR Apache-2.0
+	Licence string
 
 	// TODO(jpoole): Store these on the resolver and use packages.Module instead of this struct
 	Parts []*ModulePart
@@ -41,6 +43,38 @@ type ModulePart struct {
 	Index int
 
 	Modified bool
+
+	// MergedInto is set when this part is no longer needed, and its packages have been merged into another part
+	MergedInto *ModulePart
+}
+
+// SortedPackages returns the packages in this part sorted by their ID so they can be iterated over deterministically
+func (p *ModulePart) SortedPackages() []*packages.Package {
+	return SortPackages(p.Packages)
+}
+
+// SortPackages returns the packages in the set sorted by their ID
+func SortPackages(pkgs map[*packages.Package]struct{}) []*packages.Package {
+	ret := make([]*packages.Package, 0, len(pkgs))
+	for pkg := range pkgs {
+		ret = append(ret, pkg)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
+}
+
+// SortedImports returns the packages imported by a package sorted by their ID
+func SortedImports(pkg *packages.Package) []*packages.Package {
+	ret := make([]*packages.Package, 0, len(pkg.Imports))
+	for _, i := range pkg.Imports {
+		ret = append(ret, i)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
 }
 
 func (p *ModulePart) IsWildcardImport(pkg *packages.Package) bool {
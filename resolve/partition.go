@@ -0,0 +1,408 @@
+package resolve
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"golang.org/x/tools/go/packages"
+
+	"github.com/tatskaari/go-deps/progress"
+	. "github.com/tatskaari/go-deps/resolve/model"
+)
+
+// findCyclicModules finds the modules that are part of a cycle in the module graph, i.e. the modules in a strongly
+// connected component with more than one module in it. These are the only modules that ever need splitting into more
+// than one part.
+func (r *resolver) findCyclicModules() map[*Module]struct{} {
+	edges := map[*Module][]*Module{}
+	var modules []*Module
+	seen := map[*Module]struct{}{}
+
+	module := func(pkg *packages.Package) *Module {
+		if pkg.Module == nil || pkg.Module.Path == r.rootModuleName {
+			return nil
+		}
+		m := r.GetModule(KeyForModule(pkg.Module))
+		if _, ok := seen[m]; !ok {
+			seen[m] = struct{}{}
+			modules = append(modules, m)
+		}
+		return m
+	}
+
+	for _, pkg := range r.SortedPkgs() {
+		from := module(pkg)
+		if from == nil {
+			continue
+		}
+		for _, i := range SortedImports(pkg) {
+			if to := module(i); to != nil && to != from {
+				edges[from] = append(edges[from], to)
+			}
+		}
+	}
+
+	cyclic := map[*Module]struct{}{}
+	for _, scc := range stronglyConnectedComponents(modules, edges) {
+		if len(scc) > 1 {
+			for _, m := range scc {
+				cyclic[m] = struct{}{}
+			}
+		}
+	}
+	return cyclic
+}
+
+// stronglyConnectedComponents implements Tarjan's algorithm to find the strongly connected components of the graph
+func stronglyConnectedComponents(nodes []*Module, edges map[*Module][]*Module) [][]*Module {
+	index := map[*Module]int{}
+	lowLink := map[*Module]int{}
+	onStack := map[*Module]bool{}
+	var stack []*Module
+	var sccs [][]*Module
+
+	var strongConnect func(m *Module)
+	strongConnect = func(m *Module) {
+		index[m] = len(index)
+		lowLink[m] = index[m]
+		stack = append(stack, m)
+		onStack[m] = true
+
+		for _, next := range edges[m] {
+			if _, ok := index[next]; !ok {
+				strongConnect(next)
+				if lowLink[next] < lowLink[m] {
+					lowLink[m] = lowLink[next]
+				}
+			} else if onStack[next] && index[next] < lowLink[m] {
+				lowLink[m] = index[next]
+			}
+		}
+
+		if lowLink[m] == index[m] {
+			var scc []*Module
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				scc = append(scc, top)
+				if top == m {
+					break
+				}
+			}
+			sccs = append(sccs, scc)
+		}
+	}
+
+	for _, m := range nodes {
+		if _, ok := index[m]; !ok {
+			strongConnect(m)
+		}
+	}
+	return sccs
+}
+
+// reachableParts returns the parts of the module that the package would depend on via its imports
+func (r *resolver) reachableParts(m *Module, pkg *packages.Package) map[*ModulePart]struct{} {
+	reachable := map[*ModulePart]struct{}{}
+	done := map[*ModulePart]struct{}{}
+
+	var visit func(part *ModulePart)
+	visit = func(part *ModulePart) {
+		if _, ok := done[part]; ok {
+			return
+		}
+		done[part] = struct{}{}
+
+		if part.Module == m {
+			reachable[part] = struct{}{}
+		}
+		for pkg := range part.Packages {
+			for _, i := range pkg.Imports {
+				visit(r.Import(i))
+			}
+		}
+	}
+
+	for _, i := range SortedImports(pkg) {
+		visit(r.Import(i))
+	}
+	return reachable
+}
+
+// PartCounts returns the number of parts each module is split into
+func (mods *Modules) PartCounts() map[ModuleKey]int {
+	ret := make(map[ModuleKey]int, len(mods.Mods))
+	for key, m := range mods.Mods {
+		ret[key] = len(m.Parts)
+	}
+	return ret
+}
+
+// WritePartReport writes a table comparing the number of parts each module was split into before and after resolving.
+// Only modules that are split either side are included.
+func WritePartReport(w io.Writer, before, after map[ModuleKey]int) error {
+	keys := make([]ModuleKey, 0, len(after))
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for key := range after {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Path != keys[j].Path {
+			return keys[i].Path < keys[j].Path
+		}
+		return keys[i].Replace < keys[j].Replace
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Module\tBefore\tAfter")
+
+	totalBefore, totalAfter := 0, 0
+	for _, key := range keys {
+		totalBefore += before[key]
+		totalAfter += after[key]
+		if before[key] <= 1 && after[key] <= 1 {
+			continue
+		}
+		name := key.Path
+		if key.Replace != "" {
+			name += " => " + key.Replace
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", name, before[key], after[key])
+	}
+	fmt.Fprintf(tw, "Total (%d modules)\t%d\t%d\n", len(keys), totalBefore, totalAfter)
+	return tw.Flush()
+}
+
+// FindPartCycle returns a cycle between module parts, or nil if the part graph is acyclic
+func (mods *Modules) FindPartCycle() []*ModulePart {
+	var nodes []interface{}
+	for _, m := range mods.SortedMods() {
+		for _, part := range m.Parts {
+			nodes = append(nodes, part)
+		}
+	}
+
+	deps := func(node interface{}) []interface{} {
+		part := node.(*ModulePart)
+		var ret []interface{}
+		for _, pkg := range part.SortedPackages() {
+			for _, i := range SortedImports(pkg) {
+				if dep := mods.Import(i); dep != part {
+					ret = append(ret, dep)
+				}
+			}
+		}
+		return ret
+	}
+
+	var ret []*ModulePart
+	WalkCycles(nodes, deps, func(cycle []interface{}) bool {
+		for _, node := range cycle {
+			ret = append(ret, node.(*ModulePart))
+		}
+		return false
+	})
+	return ret
+}
+
+// mergeParts checks whether the modified modules that have been split into parts still need as many parts, and merges
+// them together if not. This happens when a new version of a module removes the cycle that caused it to be split.
+func (r *resolver) mergeParts() {
+	r.cyclicModules = r.findCyclicModules()
+	for _, m := range r.SortedMods() {
+		if len(m.Parts) < 2 || !m.IsModified() {
+			continue
+		}
+		r.mergeModuleParts(m)
+	}
+}
+
+// mergeModuleParts works out the fewest parts the module can be split into given how the other modules are split, and
+// merges its parts together if that's fewer than it has now. Modules with wildcard installs are left as they are, with
+// a warning, as we don't know all the packages the wildcards match so can't safely move them.
+func (r *resolver) mergeModuleParts(m *Module) {
+	for _, part := range m.Parts {
+		if len(part.InstallWildCards) > 0 {
+			progress.Clear()
+			fmt.Fprintf(os.Stderr, "Warning: %s is split into %d parts, which can't be merged back together as some of them install packages with a wildcard. Run go-deps narrow %s to install only the packages that are used.\n", m.Name, len(m.Parts), m.Name)
+			return
+		}
+	}
+
+	layers := map[*packages.Package]int{}
+	if _, ok := r.cyclicModules[m]; ok {
+		var ok bool
+		if layers, ok = r.layerPackages(m); !ok {
+			return
+		}
+	}
+
+	numLayers := 1
+	for _, layer := range layers {
+		if layer+1 > numLayers {
+			numLayers = layer + 1
+		}
+	}
+	if numLayers >= len(m.Parts) {
+		return
+	}
+
+	type partState struct {
+		packages map[*packages.Package]struct{}
+		modified bool
+	}
+	oldParts := append([]*ModulePart{}, m.Parts...)
+	oldState := make(map[*ModulePart]partState, len(oldParts))
+	for _, part := range oldParts {
+		oldState[part] = partState{packages: part.Packages, modified: part.Modified}
+	}
+
+	r.movePackages(m, numLayers, layers)
+
+	// Merging the module's parts can connect the parts of other modules together in new ways, so make sure we haven't
+	// introduced a cycle. If we have, put everything back the way it was.
+	if r.FindPartCycle() != nil {
+		m.Parts = oldParts
+		for i, part := range oldParts {
+			part.Index = i + 1
+			part.Packages = oldState[part].packages
+			part.Modified = oldState[part].modified
+			part.MergedInto = nil
+			for pkg := range part.Packages {
+				r.ImportPaths[pkg] = part
+			}
+		}
+	}
+}
+
+// layerPackages assigns each package in the module to a layer, one above the highest layer of the packages in the
+// module it depends on through the parts of other modules. Returns false if the packages depend on each other in a
+// cycle, in which case the module can't be split any better given how the other modules are split.
+func (r *resolver) layerPackages(m *Module) (map[*packages.Package]int, bool) {
+	inModule := map[*packages.Package]struct{}{}
+	for _, part := range m.Parts {
+		for pkg := range part.Packages {
+			inModule[pkg] = struct{}{}
+		}
+	}
+
+	// deps finds the packages in this module that the package depends on through other modules
+	deps := func(pkg *packages.Package) []*packages.Package {
+		var ret []*packages.Package
+		done := map[*ModulePart]struct{}{}
+		var visit func(pkg *packages.Package)
+		visit = func(pkg *packages.Package) {
+			if _, ok := inModule[pkg]; ok {
+				ret = append(ret, pkg)
+				return
+			}
+			part := r.Import(pkg)
+			if _, ok := done[part]; ok {
+				return
+			}
+			done[part] = struct{}{}
+			for _, p := range part.SortedPackages() {
+				for _, i := range SortedImports(p) {
+					visit(i)
+				}
+			}
+		}
+		for _, i := range SortedImports(pkg) {
+			visit(i)
+		}
+		return ret
+	}
+
+	layers := map[*packages.Package]int{}
+	visiting := map[*packages.Package]bool{}
+	var layer func(pkg *packages.Package) (int, bool)
+	layer = func(pkg *packages.Package) (int, bool) {
+		if l, ok := layers[pkg]; ok {
+			return l, true
+		}
+		if visiting[pkg] {
+			return 0, false
+		}
+		visiting[pkg] = true
+		l := 0
+		for _, dep := range deps(pkg) {
+			depLayer, ok := layer(dep)
+			if !ok {
+				return 0, false
+			}
+			if depLayer+1 > l {
+				l = depLayer + 1
+			}
+		}
+		visiting[pkg] = false
+		layers[pkg] = l
+		return l, true
+	}
+
+	for _, pkg := range SortPackages(inModule) {
+		if _, ok := layer(pkg); !ok {
+			return nil, false
+		}
+	}
+	return layers, true
+}
+
+// movePackages moves the module's packages into the last n parts by their layer. The last part is the namesake of the
+// module, so we keep the parts at the end. The rest are removed, and marked as merged into the part that got most of
+// their packages.
+func (r *resolver) movePackages(m *Module, n int, layers map[*packages.Package]int) {
+	kept := m.Parts[len(m.Parts)-n:]
+	removed := m.Parts[:len(m.Parts)-n]
+
+	oldParts := map[*packages.Package]*ModulePart{}
+	for _, part := range m.Parts {
+		for pkg := range part.Packages {
+			oldParts[pkg] = part
+		}
+		part.Packages = map[*packages.Package]struct{}{}
+	}
+
+	moved := map[*ModulePart]map[*ModulePart]int{}
+	for _, pkg := range SortPackages(packageSet(oldParts)) {
+		into := kept[layers[pkg]]
+		into.Packages[pkg] = struct{}{}
+		r.ImportPaths[pkg] = into
+
+		from := oldParts[pkg]
+		if moved[from] == nil {
+			moved[from] = map[*ModulePart]int{}
+		}
+		moved[from][into]++
+	}
+
+	// Prefer the namesake, which is the last part, if there's a tie
+	for _, part := range removed {
+		for i := len(kept) - 1; i >= 0; i-- {
+			if part.MergedInto == nil || moved[part][kept[i]] > moved[part][part.MergedInto] {
+				part.MergedInto = kept[i]
+			}
+		}
+	}
+
+	m.Parts = kept
+	for i, part := range kept {
+		part.Index = i + 1
+		part.Modified = true
+	}
+}
+
+func packageSet(pkgs map[*packages.Package]*ModulePart) map[*packages.Package]struct{} {
+	ret := make(map[*packages.Package]struct{}, len(pkgs))
+	for pkg := range pkgs {
+		ret[pkg] = struct{}{}
+	}
+	return ret
+}
@@ -7,11 +7,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
-	"github.com/google/go-licenses/licenses"
 	"golang.org/x/tools/go/packages"
 
+	"github.com/tatskaari/go-deps/licence"
+	"github.com/tatskaari/go-deps/policy"
 	"github.com/tatskaari/go-deps/progress"
 	"github.com/tatskaari/go-deps/resolve/knownimports"
 	. "github.com/tatskaari/go-deps/resolve/model"
@@ -33,6 +35,9 @@ type resolver struct {
 	rootModuleName string
 	config         *packages.Config
 	resolved       map[*packages.Package]struct{}
+
+	// The modules that are part of a cycle in the module graph, and so might need to be split into parts
+	cyclicModules map[*Module]struct{}
 }
 
 func newResolver(rootModuleName string, config *packages.Config) *resolver {
@@ -59,8 +64,8 @@ func (r *resolver) dependsOn(done map[*packages.Package]struct{}, pkg *packages.
 	if module == pkgModule {
 		return true
 	}
-	for pkg := range pkgModule.Packages {
-		for _, i := range pkg.Imports {
+	for _, pkg := range pkgModule.SortedPackages() {
+		for _, i := range SortedImports(pkg) {
 			if r.dependsOn(done, i, module) {
 				return true
 			}
@@ -70,35 +75,41 @@ func (r *resolver) dependsOn(done map[*packages.Package]struct{}, pkg *packages.
 	return false
 }
 
-// getOrCreateModulePart gets or create a module part that we can add this package to without causing a cycle
+// getOrCreateModulePart gets or create a module part that we can add this package to without causing a cycle.
+//
+// Only modules that are part of a cycle in the module graph can ever need splitting. For those, we find all the parts
+// of the module that the package depends on through its imports in one pass, and add it to the first part not among
+// them. Packages are added after their imports, so the parts of a module form layers, where each part depends on the
+// ones before it. A new part is only created when the package depends on every existing layer, so the module is split
+// into as many parts as the longest chain of dependencies that leave and re-enter it, which is the fewest possible.
 func (r *resolver) getOrCreateModulePart(m *Module, pkg *packages.Package) *ModulePart {
-	var validPart *ModulePart
+	if r.cyclicModules == nil {
+		r.cyclicModules = r.findCyclicModules()
+	}
+
+	if _, ok := r.cyclicModules[m]; !ok && len(m.Parts) > 0 {
+		return m.Parts[0]
+	}
+
+	reachable := r.reachableParts(m, pkg)
 	for _, part := range m.Parts {
-		valid := true
-		done := map[*packages.Package]struct{}{}
-		for _, i := range pkg.Imports {
-			// Check all the imports that leave the current part
-			if r.Import(i) != part {
-				if r.dependsOn(done, i, part) {
-					valid = false
-					break
-				}
-			}
-		}
-		if valid {
-			validPart = part
-			break
+		if _, ok := reachable[part]; !ok {
+			return part
 		}
 	}
-	if validPart == nil {
-		validPart = &ModulePart{
-			Packages: map[*packages.Package]struct{}{},
-			Module:   m,
-			Index:    len(m.Parts) + 1,
-		}
-		m.Parts = append(m.Parts, validPart)
+
+	// The new part becomes the namesake of the module so the old namesake needs updating too
+	if len(m.Parts) > 0 {
+		m.Parts[len(m.Parts)-1].Modified = true
 	}
-	return validPart
+
+	part := &ModulePart{
+		Packages: map[*packages.Package]struct{}{},
+		Module:   m,
+		Index:    len(m.Parts) + 1,
+	}
+	m.Parts = append(m.Parts, part)
+	return part
 }
 
 func (r *resolver) addPackageToModuleGraph(done map[*packages.Package]struct{}, pkg *packages.Package) {
@@ -106,7 +117,7 @@ func (r *resolver) addPackageToModuleGraph(done map[*packages.Package]struct{},
 		return
 	}
 
-	for _, i := range pkg.Imports {
+	for _, i := range SortedImports(pkg) {
 		r.addPackageToModuleGraph(done, i)
 	}
 
@@ -136,18 +147,31 @@ func getCurrentModuleName(goTool string) string {
 	return strings.TrimSpace(string(out))
 }
 
+// addPackagesToModules adds all the packages to the module graph. The packages are visited in order, so the same set of
+// packages always results in the same module parts.
 func (r *resolver) addPackagesToModules(done map[*packages.Package]struct{}) {
 	processed := 0
+	r.cyclicModules = r.findCyclicModules()
 
-	for _, pkg := range r.Pkgs {
+	for _, pkg := range r.SortedPkgs() {
 		r.addPackageToModuleGraph(done, pkg)
 		processed++
 		progress.PrintUpdate("Building module graph... %d of %d packages.", processed, len(r.Pkgs))
 	}
 }
 
+// Options configures how the modules are updated
+type Options struct {
+	// KeepParts stops modules that have been split into parts being merged back together when they no longer need to be
+	KeepParts bool
+	// Licences detects the licences of the modules. The default classifier is used if this isn't set.
+	Licences *licence.Detector
+	// Policy restricts which modules can be used. Any module is allowed if this isn't set.
+	Policy *policy.Policy
+}
+
 // UpdateModules resolves a `go get` style wildcard and updates the modules passed in to it
-func UpdateModules(goTool string, modules *Modules, getPaths []string, goListDriver packages.Driver) error {
+func UpdateModules(goTool string, modules *Modules, getPaths []string, goListDriver packages.Driver, opts Options) error {
 	defer progress.Clear()
 
 	pkgs, r, err := load(goTool, getPaths, goListDriver)
@@ -159,6 +183,10 @@ func UpdateModules(goTool string, modules *Modules, getPaths []string, goListDri
 		return nil
 	}
 
+	if err := checkPolicy(pkgs, r.rootModuleName, opts.Policy); err != nil {
+		return err
+	}
+
 	r.Modules = modules
 
 	done := map[*packages.Package]struct{}{}
@@ -175,10 +203,17 @@ func UpdateModules(goTool string, modules *Modules, getPaths []string, goListDri
 		return err
 	}
 
-	if err := r.setLicence(pkgs); err != nil {
-		return err
+	if !opts.KeepParts {
+		r.mergeParts()
 	}
 
+	detector := opts.Licences
+	if detector == nil {
+		if detector, err = licence.NewDetector(licence.DefaultThreshold, nil); err != nil {
+			return err
+		}
+	}
+	r.setLicence(pkgs, detector)
 	return nil
 }
 
@@ -217,10 +252,10 @@ func (r *resolver) isResolved(pkg *packages.Package) bool {
 
 func (r *resolver) resolveModifiedPackages(done map[*packages.Package]struct{}) error {
 	var modifiedPackages []string
-	for _, m := range r.Mods {
+	for _, m := range r.SortedMods() {
 		if m.IsModified() {
 			for _, part := range m.Parts {
-				for pkg := range part.Packages {
+				for _, pkg := range part.SortedPackages() {
 					if !r.isResolved(pkg) {
 						modifiedPackages = append(modifiedPackages, pkg.ID)
 					}
@@ -268,8 +303,15 @@ func (r *resolver) resolve(pkgs []*packages.Package) {
 			pkg.Module = p.Module
 		}
 
+		importNames := make([]string, 0, len(p.Imports))
+		for importName := range p.Imports {
+			importNames = append(importNames, importName)
+		}
+		sort.Strings(importNames)
+
 		newPackages := make([]*packages.Package, 0, len(p.Imports))
-		for importName, importedPkg := range p.Imports {
+		for _, importName := range importNames {
+			importedPkg := p.Imports[importName]
 			if knownimports.IsInGoRoot(importName) {
 				continue
 			}
@@ -311,6 +353,38 @@ func (mods *Modules) Import(pkg *packages.Package) *ModulePart {
 	panic(fmt.Errorf("no import path for pkg %v", pkg.ID))
 }
 
+// SortedPkgs returns all the packages sorted by their import path
+func (mods *Modules) SortedPkgs() []*packages.Package {
+	ret := make([]*packages.Package, 0, len(mods.Pkgs))
+	for _, pkg := range mods.Pkgs {
+		ret = append(ret, pkg)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
+}
+
+// SortedMods returns all the modules sorted by their path, and then the path they're replaced by
+func (mods *Modules) SortedMods() []*Module {
+	keys := make([]ModuleKey, 0, len(mods.Mods))
+	for key := range mods.Mods {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Path != keys[j].Path {
+			return keys[i].Path < keys[j].Path
+		}
+		return keys[i].Replace < keys[j].Replace
+	})
+
+	ret := make([]*Module, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, mods.Mods[key])
+	}
+	return ret
+}
+
 // GetPackage gets an existing package or creates a new one
 func (mods *Modules) GetPackage(path string) *packages.Package {
 	if pkg, ok := mods.Pkgs[path]; ok {
@@ -343,60 +417,157 @@ func (mods *Modules) GetModule(key ModuleKey) *Module {
 	return m
 }
 
-func (r *resolver) setLicence(pkgs []*packages.Package) (err error) {
-	c, _ := licenses.NewClassifier(0.9)
+// IsProvided returns true if a module part installs the package, either explicitly or through a wildcard
+func (mods *Modules) IsProvided(path string) bool {
+	return mods.Provider(path) != nil
+}
 
-	done := 0 // start at 1 to ignore the root module
-	packages.Visit(pkgs, nil, func(p *packages.Package) {
-		if err != nil {
-			return
-		}
-		if _, ok := r.Pkgs[p.PkgPath]; !ok {
-			return
+// Provider returns the module part that installs the package, or nil if no part does
+func (mods *Modules) Provider(path string) *ModulePart {
+	if pkg, ok := mods.Pkgs[path]; ok {
+		if part, ok := mods.ImportPaths[pkg]; ok {
+			return part
 		}
-		var m *Module
-		if p.Module == nil {
-			if strings.HasPrefix(p.PkgPath, r.rootModuleName) {
-				m = r.Mods[ModuleKey{Path: r.rootModuleName}]
-			} else {
-				return
+	}
+
+	for _, m := range mods.SortedMods() {
+		for _, part := range m.Parts {
+			for _, i := range part.InstallWildCards {
+				wildcard := filepath.Join(m.Name, i)
+				if path == wildcard || strings.HasPrefix(path, wildcard+"/") {
+					return part
+				}
 			}
-		} else {
-			m = r.Mods[KeyForModule(p.Module)]
 		}
-		if !m.IsModified() {
+	}
+	return nil
+}
+
+// setLicence detects the licences of the modules that have been modified. Every licence file in the module is
+// classified, so modules with more than one licence get an SPDX expression covering all of them. Problems detecting a
+// module's licence are reported as warnings, and the module's licence is left unknown.
+func (r *resolver) setLicence(pkgs []*packages.Package, detector *licence.Detector) {
+	done := map[*Module]struct{}{}
+	packages.Visit(pkgs, nil, func(p *packages.Package) {
+		if _, ok := r.Pkgs[p.PkgPath]; !ok || p.Module == nil {
 			return
 		}
-		if m.Licence != "" || m.Name == r.rootModuleName {
+		m := r.Mods[KeyForModule(p.Module)]
+		if m == nil || !m.IsModified() || m.Name == r.rootModuleName {
 			return
 		}
-
-		done++
-		progress.PrintUpdate("Adding licenses... %d of %d modules.", done, len(r.Mods))
-
-		var pkgDir string
-		switch {
-		case len(p.GoFiles) > 0:
-			pkgDir = filepath.Dir(p.GoFiles[0])
-		case len(p.CompiledGoFiles) > 0:
-			pkgDir = filepath.Dir(p.CompiledGoFiles[0])
-		case len(p.OtherFiles) > 0:
-			pkgDir = filepath.Dir(p.OtherFiles[0])
-		default:
-			// This package is empty - nothing to do.
+		if _, ok := done[m]; ok {
 			return
 		}
 
-		path, e := licenses.Find(pkgDir, c)
-		if e != nil {
+		dir := moduleDir(p)
+		if dir == "" {
+			// This package is empty so we can't tell where the module is. Another package might tell us.
 			return
 		}
-		name, _, e := c.Identify(path)
-		if e != nil {
-			err = fmt.Errorf("failed to identify licence %v: %v", path, err)
+		done[m] = struct{}{}
+		progress.PrintUpdate("Adding licenses... %d of %d modules.", len(done), len(r.Mods))
+
+		detection, err := detector.Detect(m.Name, dir)
+		if err != nil {
+			progress.Clear()
+			fmt.Fprintf(os.Stderr, "Warning: failed to detect the licence of %s: %v\n", m.Name, err)
 			return
 		}
-		m.Licence = name
+		for _, warning := range detection.Warnings {
+			progress.Clear()
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", m.Name, warning)
+		}
+		m.Licence = detection.Licence
 	})
-	return
+}
+
+// checkPolicy checks the modules of the packages, and everything they import, are allowed by the policy. The packages
+// are visited breadth first, so each violation is reported with the shortest import chain that pulled the module in.
+func checkPolicy(pkgs []*packages.Package, rootModuleName string, p *policy.Policy) error {
+	if p.IsEmpty() {
+		return nil
+	}
+
+	parents := map[*packages.Package]*packages.Package{}
+	queue := make([]*packages.Package, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		if _, ok := parents[pkg]; !ok {
+			parents[pkg] = nil
+			queue = append(queue, pkg)
+		}
+	}
+
+	checked := map[ModuleKey]struct{}{}
+	var violations []*policy.Violation
+	for len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+
+		if mod := pkg.Module; mod != nil && mod.Path != rootModuleName {
+			key := KeyForModule(mod)
+			if _, ok := checked[key]; !ok {
+				checked[key] = struct{}{}
+				v := p.Check(mod.Path, mod.Version)
+				if v == nil && mod.Replace != nil && mod.Replace.Version != "" {
+					v = p.Check(mod.Replace.Path, mod.Replace.Version)
+				}
+				if v != nil {
+					v.Chain = importChain(parents, pkg)
+					violations = append(violations, v)
+				}
+			}
+		}
+
+		for _, i := range SortedImports(pkg) {
+			if _, ok := parents[i]; !ok {
+				parents[i] = pkg
+				queue = append(queue, i)
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &policy.Error{Violations: violations}
+	}
+	return nil
+}
+
+// importChain returns the import paths of the packages from the one that was asked for down to this one
+func importChain(parents map[*packages.Package]*packages.Package, pkg *packages.Package) []string {
+	var ret []string
+	for ; pkg != nil; pkg = parents[pkg] {
+		ret = append([]string{pkg.PkgPath}, ret...)
+	}
+	return ret
+}
+
+// moduleDir returns the directory the package's module was downloaded to. This is worked out from where the package's
+// files are, as the driver doesn't always tell us.
+func moduleDir(p *packages.Package) string {
+	if p.Module.Dir != "" {
+		return p.Module.Dir
+	}
+
+	var pkgDir string
+	switch {
+	case len(p.GoFiles) > 0:
+		pkgDir = filepath.Dir(p.GoFiles[0])
+	case len(p.CompiledGoFiles) > 0:
+		pkgDir = filepath.Dir(p.CompiledGoFiles[0])
+	case len(p.OtherFiles) > 0:
+		pkgDir = filepath.Dir(p.OtherFiles[0])
+	default:
+		return ""
+	}
+
+	rel := strings.TrimPrefix(strings.TrimPrefix(p.PkgPath, p.Module.Path), "/")
+	if rel == "" {
+		return pkgDir
+	}
+	rel = filepath.FromSlash(rel)
+	if !strings.HasSuffix(pkgDir, string(filepath.Separator)+rel) {
+		return pkgDir
+	}
+	return strings.TrimSuffix(pkgDir, string(filepath.Separator)+rel)
 }
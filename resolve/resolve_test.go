@@ -5,6 +5,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/tatskaari/go-deps/config"
+	"github.com/tatskaari/go-deps/policy"
 	. "github.com/tatskaari/go-deps/resolve/model"
 
 	"github.com/stretchr/testify/require"
@@ -47,8 +49,9 @@ func TestDependsOn(t *testing.T) {
 	require.True(t, ok)
 }
 
-func TestResolvesCycle(t *testing.T) {
-	// This package structure is a simplified form of the google.golang.com/go module
+// newCycleFixture creates a resolver with a package structure that is a simplified form of the cloud.google.com/go
+// module, where the module has to be split to avoid a cycle.
+func newCycleFixture(t *testing.T) *resolver {
 	ps := map[string][]string{
 		"google.golang.org/grpc/codes":             {},
 		"google.golang.org/grpc":                   {},
@@ -84,14 +87,30 @@ func TestResolvesCycle(t *testing.T) {
 			pkg.Imports[importedPackage.ID] = importedPackage
 		}
 	}
+	return r
+}
+
+// partitions returns the IDs of the packages in each part of the module
+func partitions(m *Module) [][]string {
+	ret := make([][]string, 0, len(m.Parts))
+	for _, part := range m.Parts {
+		var ids []string
+		for _, pkg := range part.SortedPackages() {
+			ids = append(ids, pkg.ID)
+		}
+		ret = append(ret, ids)
+	}
+	return ret
+}
 
+func TestResolvesCycle(t *testing.T) {
+	r := newCycleFixture(t)
 	r.addPackagesToModules(map[*packages.Package]struct{}{})
 
 	// Check we don't have a cycle
 	module, ok := r.Mods[ModuleKey{Path: "cloud.google.com/go"}]
 	require.True(t, ok)
 
-	// TODO(jpoole): Make the generated module graph deterministic so we don't have to have a complicated assertion here
 	for _, part := range module.Parts {
 		deps := map[*ModulePart]struct{}{}
 		findModuleDeps(r, part, part, deps)
@@ -99,6 +118,31 @@ func TestResolvesCycle(t *testing.T) {
 		_, hasSelfDep := deps[part]
 		require.False(t, hasSelfDep, "found dependency cycle")
 	}
+
+	require.Equal(t, [][]string{
+		{"cloud.google.com/go/compute/metadata", "cloud.google.com/go/talent/apiv4beta1"},
+	}, partitions(module))
+
+	// grpc/credentials/oauth depends on cloud.google.com/go/compute/metadata via oauth2 so must be split out from the
+	// rest of grpc, which cloud.google.com/go/talent/apiv4beta1 depends on.
+	require.Equal(t, [][]string{
+		{"google.golang.org/grpc", "google.golang.org/grpc/codes", "google.golang.org/grpc/metadata", "google.golang.org/grpc/status"},
+		{"google.golang.org/grpc/credentials/oauth"},
+	}, partitions(r.Mods[ModuleKey{Path: "google.golang.org/grpc"}]))
+}
+
+func TestResolvesCycleDeterministically(t *testing.T) {
+	expected := partitions(func() *resolver {
+		r := newCycleFixture(t)
+		r.addPackagesToModules(map[*packages.Package]struct{}{})
+		return r
+	}().Mods[ModuleKey{Path: "cloud.google.com/go"}])
+
+	for i := 0; i < 10; i++ {
+		r := newCycleFixture(t)
+		r.addPackagesToModules(map[*packages.Package]struct{}{})
+		require.Equal(t, expected, partitions(r.Mods[ModuleKey{Path: "cloud.google.com/go"}]))
+	}
 }
 
 // findModuleDeps will return all the module parts (i.e. the go_module()) rules a module part depends on
@@ -122,3 +166,177 @@ func findModuleDeps(r *resolver, from *ModulePart, currentPart *ModulePart, part
 		}
 	}
 }
+
+func TestSplitsModuleIntoFewestParts(t *testing.T) {
+	r := newResolver(".", nil)
+
+	// Package structure, where each import leaves and re-enters the modules:
+	// m/a2 --> n/n1 --> m/a1 --> n/n0 --> m/a0
+	// o/o1 --> m/a0
+	imports := map[string][]string{
+		"m/a0":  {},
+		"m/a1":  {"n/n0"},
+		"m/a2":  {"n/n1"},
+		"n/n0":  {"m/a0"},
+		"n/n1":  {"m/a1"},
+		"o/o1":  {"m/a0"},
+		"o/foo": {},
+	}
+	for path, is := range imports {
+		pkg := r.GetPackage(path)
+		pkg.Module = &packages.Module{Path: strings.Split(path, "/")[0]}
+		for _, i := range is {
+			pkg.Imports[i] = r.GetPackage(i)
+		}
+	}
+
+	r.addPackagesToModules(map[*packages.Package]struct{}{})
+
+	require.Equal(t, [][]string{{"m/a0"}, {"m/a1"}, {"m/a2"}}, partitions(r.Mods[ModuleKey{Path: "m"}]))
+	require.Equal(t, [][]string{{"n/n0"}, {"n/n1"}}, partitions(r.Mods[ModuleKey{Path: "n"}]))
+
+	// o isn't part of a cycle so is never split
+	require.Equal(t, [][]string{{"o/foo", "o/o1"}}, partitions(r.Mods[ModuleKey{Path: "o"}]))
+}
+
+func TestWritePartReport(t *testing.T) {
+	before := map[ModuleKey]int{{Path: "a"}: 3, {Path: "b"}: 1, {Path: "c"}: 2}
+	after := map[ModuleKey]int{{Path: "a"}: 2, {Path: "b"}: 1, {Path: "d"}: 2}
+
+	buf := new(strings.Builder)
+	require.NoError(t, WritePartReport(buf, before, after))
+	require.Equal(t, `Module             Before  After
+a                  3       2
+c                  2       0
+d                  0       2
+Total (4 modules)  6       5
+`, buf.String())
+}
+
+func TestMergesPartsWhenNoLongerNeeded(t *testing.T) {
+	r := newResolver(".", nil)
+
+	// The module was split into two parts to break a cycle through n, but n no longer imports m/a0
+	m := r.GetModule(ModuleKey{Path: "m"})
+	a0, a1 := r.GetPackage("m/a0"), r.GetPackage("m/a1")
+	n0 := r.GetPackage("n/n0")
+	a0.Module = &packages.Module{Path: "m"}
+	a1.Module = &packages.Module{Path: "m"}
+	n0.Module = &packages.Module{Path: "n"}
+	a1.Imports[n0.ID] = n0
+
+	first := &ModulePart{Module: m, Index: 1, Packages: map[*packages.Package]struct{}{a0: {}}, Modified: true}
+	second := &ModulePart{Module: m, Index: 2, Packages: map[*packages.Package]struct{}{a1: {}}, Modified: true}
+	m.Parts = []*ModulePart{first, second}
+	r.ImportPaths[a0] = first
+	r.ImportPaths[a1] = second
+	r.addPackageToModuleGraph(map[*packages.Package]struct{}{a0: {}, a1: {}}, n0)
+
+	r.mergeParts()
+
+	require.Equal(t, [][]string{{"m/a0", "m/a1"}}, partitions(m))
+	require.Equal(t, second, first.MergedInto)
+	require.Equal(t, 1, second.Index)
+	require.Equal(t, second, r.ImportPaths[a0])
+}
+
+func TestKeepsPartsNeededToBreakCycle(t *testing.T) {
+	r := newResolver(".", nil)
+
+	// m/a1 --> n/n0 --> m/a0
+	m := r.GetModule(ModuleKey{Path: "m"})
+	a0, a1 := r.GetPackage("m/a0"), r.GetPackage("m/a1")
+	n0 := r.GetPackage("n/n0")
+	a0.Module = &packages.Module{Path: "m"}
+	a1.Module = &packages.Module{Path: "m"}
+	n0.Module = &packages.Module{Path: "n"}
+	a1.Imports[n0.ID] = n0
+	n0.Imports[a0.ID] = a0
+
+	first := &ModulePart{Module: m, Index: 1, Packages: map[*packages.Package]struct{}{a0: {}}, Modified: true}
+	second := &ModulePart{Module: m, Index: 2, Packages: map[*packages.Package]struct{}{a1: {}}, Modified: true}
+	m.Parts = []*ModulePart{first, second}
+	r.ImportPaths[a0] = first
+	r.ImportPaths[a1] = second
+	r.addPackageToModuleGraph(map[*packages.Package]struct{}{a0: {}, a1: {}}, n0)
+
+	r.mergeParts()
+
+	require.Equal(t, [][]string{{"m/a0"}, {"m/a1"}}, partitions(m))
+	require.Nil(t, first.MergedInto)
+	require.Nil(t, r.FindPartCycle())
+}
+
+func TestModuleDir(t *testing.T) {
+	pkg := &packages.Package{
+		PkgPath: "example.com/foo/bar/baz",
+		GoFiles: []string{"/mods/example.com/foo@v1.0.0/bar/baz/baz.go"},
+		Module:  &packages.Module{Path: "example.com/foo"},
+	}
+	require.Equal(t, "/mods/example.com/foo@v1.0.0", moduleDir(pkg))
+
+	pkg.Module.Dir = "/somewhere/else"
+	require.Equal(t, "/somewhere/else", moduleDir(pkg))
+
+	require.Equal(t, "", moduleDir(&packages.Package{PkgPath: "example.com/foo", Module: &packages.Module{Path: "example.com/foo"}}))
+}
+
+func TestCheckPolicy(t *testing.T) {
+	p, err := policy.New(config.Config{
+		`bannedmodule "example.com/banned"`: {"reason": {"It's unmaintained"}},
+	})
+	require.NoError(t, err)
+
+	banned := &packages.Package{PkgPath: "example.com/banned/pkg", Module: &packages.Module{Path: "example.com/banned", Version: "v1.0.0"}}
+	lib := &packages.Package{
+		PkgPath: "example.com/lib",
+		Module:  &packages.Module{Path: "example.com/lib", Version: "v1.0.0"},
+		Imports: map[string]*packages.Package{banned.PkgPath: banned},
+	}
+	app := &packages.Package{
+		PkgPath: "example.com/app/cmd",
+		Module:  &packages.Module{Path: "example.com/app"},
+		Imports: map[string]*packages.Package{lib.PkgPath: lib},
+	}
+
+	require.NoError(t, checkPolicy([]*packages.Package{app}, "example.com/app", nil))
+
+	err = checkPolicy([]*packages.Package{app}, "example.com/app", p)
+	require.Error(t, err)
+	violations := err.(*policy.Error).Violations
+	require.Len(t, violations, 1)
+	require.Equal(t, "example.com/banned", violations[0].Module)
+	require.Equal(t, []string{"example.com/app/cmd", "example.com/lib", "example.com/banned/pkg"}, violations[0].Chain)
+}
+
+func TestWriteSummary(t *testing.T) {
+	before := map[ModuleKey]ModuleState{
+		{Path: "a"}: {Version: "v1.0.0", Parts: 1},
+		{Path: "b"}: {Version: "v1.2.0", Parts: 1},
+		{Path: "c"}: {Version: "v1.0.0", Parts: 3},
+		{Path: "d"}: {Version: "v1.0.0", Parts: 1},
+		{Path: "e"}: {Version: "v1.0.0", Parts: 1},
+	}
+	after := map[ModuleKey]ModuleState{
+		{Path: "a"}: {Version: "v1.1.0", Parts: 2},
+		{Path: "b"}: {Version: "v1.1.0", Parts: 1},
+		{Path: "c"}: {Version: "v1.0.0", Parts: 1},
+		{Path: "e"}: {Version: "v1.0.0", Parts: 1},
+		{Path: "f"}: {Version: "v0.1.0", Parts: 1},
+		{Path: "g"}: {Version: "v0.1.0"},
+	}
+
+	buf := new(strings.Builder)
+	require.NoError(t, WriteSummary(buf, before, after))
+	require.Equal(t, `Upgraded a v1.0.0 -> v1.1.0
+Split a into 2 parts (was 1)
+Downgraded b v1.2.0 -> v1.1.0
+Merged the parts of c into 1 (was 3)
+Removed d v1.0.0
+Added f v0.1.0
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteSummary(buf, before, before))
+	require.Equal(t, "No changes to the third party modules\n", buf.String())
+}
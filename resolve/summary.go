@@ -0,0 +1,93 @@
+package resolve
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/mod/semver"
+)
+
+// ModuleState is the version of a module, and how many parts it's split into, at some point in time
+type ModuleState struct {
+	Version string
+	Parts   int
+}
+
+// Snapshot returns the state of each module, so the changes made by resolving can be summarised afterwards
+func (mods *Modules) Snapshot() map[ModuleKey]ModuleState {
+	ret := make(map[ModuleKey]ModuleState, len(mods.Mods))
+	for key, m := range mods.Mods {
+		ret[key] = ModuleState{Version: m.Version, Parts: len(m.Parts)}
+	}
+	return ret
+}
+
+// WriteSummary writes a line for each module that was added, upgraded, downgraded or removed, and each module that was
+// split into more parts, or had its parts merged, between the two snapshots. This is short enough to go in a PR
+// description.
+func WriteSummary(w io.Writer, before, after map[ModuleKey]ModuleState) error {
+	keys := make([]ModuleKey, 0, len(after))
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for key := range after {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Path != keys[j].Path {
+			return keys[i].Path < keys[j].Path
+		}
+		return keys[i].Replace < keys[j].Replace
+	})
+
+	var lines []string
+	for _, key := range keys {
+		name := key.Path
+		if key.Replace != "" {
+			name += " => " + key.Replace
+		}
+
+		// Modules without any parts aren't installed, e.g. modules only found while working out versions
+		was, wasInstalled := before[key]
+		is, isInstalled := after[key]
+		wasInstalled = wasInstalled && was.Parts > 0
+		isInstalled = isInstalled && is.Parts > 0
+
+		switch {
+		case !wasInstalled && isInstalled:
+			lines = append(lines, fmt.Sprintf("Added %s %s", name, is.Version))
+		case wasInstalled && !isInstalled:
+			lines = append(lines, fmt.Sprintf("Removed %s %s", name, was.Version))
+		case !wasInstalled && !isInstalled:
+			continue
+		default:
+			switch c := semver.Compare(is.Version, was.Version); {
+			case c > 0:
+				lines = append(lines, fmt.Sprintf("Upgraded %s %s -> %s", name, was.Version, is.Version))
+			case c < 0:
+				lines = append(lines, fmt.Sprintf("Downgraded %s %s -> %s", name, was.Version, is.Version))
+			case is.Version != was.Version:
+				lines = append(lines, fmt.Sprintf("Changed %s %s -> %s", name, was.Version, is.Version))
+			}
+			if is.Parts > was.Parts {
+				lines = append(lines, fmt.Sprintf("Split %s into %d parts (was %d)", name, is.Parts, was.Parts))
+			} else if is.Parts < was.Parts {
+				lines = append(lines, fmt.Sprintf("Merged the parts of %s into %d (was %d)", name, is.Parts, was.Parts))
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		_, err := fmt.Fprintln(w, "No changes to the third party modules")
+		return err
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package rules
+
+import (
+	"github.com/bazelbuild/buildtools/build"
+)
+
+// Backend reads and writes the third party rules for a build system. The graph keeps track of the modules, and which
+// rules are for which module, so the resolver can be shared between build systems.
+type Backend interface {
+	// Parse parses the file at the path. The data is empty if the file doesn't exist yet.
+	Parse(path string, data []byte) (*build.File, error)
+	// Read reads the modules from the rules in the file into the graph
+	Read(g *BuildGraph, file *BuildFile) error
+	// Update updates the rules for the modules in the graph that have been modified
+	Update(g *BuildGraph, structured bool, thirdPartyFolder string) error
+}
+
+// PleaseBackend reads and writes go_module(), go_repo() and go_mod_download() rules for Please
+type PleaseBackend struct{}
@@ -0,0 +1,234 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bazelbuild/buildtools/build"
+	"github.com/bazelbuild/buildtools/edit"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/tatskaari/go-deps/resolve"
+	"github.com/tatskaari/go-deps/resolve/model"
+)
+
+const (
+	// gazelleDeps is the file rules_go's go_repository() is loaded from
+	gazelleDeps = "@bazel_gazelle//:deps.bzl"
+	// bazelMacro is the function new go_repository() rules are added to in a .bzl file
+	bazelMacro = "go_dependencies"
+)
+
+// BazelBackend reads and writes rules_go go_repository() rules for Bazel. All the rules live in a single file: either a
+// .bzl file, where they're added to the go_dependencies() macro, or a MODULE.bazel-style file, where they're top level
+// calls to go_repository() loaded with use_repo_rule().
+//
+// Gazelle generates the BUILD files for each repository, and works out the deps between packages itself, so there's one
+// rule per module, and the parts the resolver splits modules into don't matter.
+type BazelBackend struct {
+	// Path is the file that contains the go_repository() rules
+	Path string
+}
+
+// Parse parses the file as a .bzl file, or as a MODULE.bazel or WORKSPACE file, based on its name
+func (b *BazelBackend) Parse(path string, data []byte) (*build.File, error) {
+	return build.Parse(path, data)
+}
+
+// Read reads the go_repository() rules in the file
+func (b *BazelBackend) Read(g *BuildGraph, file *BuildFile) error {
+	for _, rule := range file.File.Rules("go_repository") {
+		moduleName := rule.AttrString("importpath")
+		if moduleName == "" {
+			continue
+		}
+
+		module := g.Modules.GetModule(resolve.ModuleKey{Path: moduleName, Replace: rule.AttrString("replace")})
+		g.ModFiles[module] = file
+
+		part := &model.ModulePart{
+			Module:   module,
+			Packages: map[*packages.Package]struct{}{},
+			Index:    len(module.Parts) + 1,
+		}
+		module.Parts = append(module.Parts, part)
+
+		file.ModRules[part] = rule
+		file.usedNames[rule.Name()] = module.Name
+		file.partNames[part] = rule.Name()
+		file.moduleNames[module] = rule.Name()
+
+		module.Version = rule.AttrString("version")
+	}
+	return nil
+}
+
+// Update updates the go_repository() rules for the modules that have been modified. The sum is removed when the version
+// changes, as it's for the old version.
+func (b *BazelBackend) Update(g *BuildGraph, _ bool, _ string) error {
+	file, ok := g.Files[b.Path]
+	if !ok {
+		f, err := g.newFile(b.Path)
+		if err != nil {
+			return err
+		}
+		g.Files[b.Path] = f
+		file = f
+	}
+
+	for _, m := range g.Modules.SortedMods() {
+		g.ModFiles[m] = file
+		if !m.IsModified() {
+			continue
+		}
+
+		var rule *build.Rule
+		for _, part := range m.Parts {
+			if r, ok := file.ModRules[part]; ok {
+				rule = r
+			}
+		}
+		if rule == nil {
+			rule = b.newRule(file, file.repositoryName(m))
+		}
+		for _, part := range m.Parts {
+			file.ModRules[part] = rule
+		}
+
+		setAttr(rule, "importpath", NewStringExpr(m.Name))
+		if m.ReplacedBy != "" {
+			setAttr(rule, "replace", NewStringExpr(m.ReplacedBy))
+		} else {
+			rule.DelAttr("replace")
+		}
+		if m.Version != "" {
+			if rule.AttrString("version") != m.Version {
+				rule.DelAttr("sum")
+			}
+			setAttr(rule, "version", NewStringExpr(m.Version))
+		}
+	}
+	return nil
+}
+
+// newRule adds a go_repository() rule to the file. In a .bzl file, the rule goes in the go_dependencies() macro.
+func (b *BazelBackend) newRule(file *BuildFile, name string) *build.Rule {
+	f := file.File
+	rule := newRule("go_repository", name)
+	rule.Call.ForceMultiLine = true
+
+	if f.Type != build.TypeBzl {
+		if !definesRepositoryRule(f) {
+			f.Stmt = appendStmt(f.Stmt, &build.AssignExpr{
+				LHS: &build.Ident{Name: "go_repository"},
+				Op:  "=",
+				RHS: &build.CallExpr{
+					X:    &build.Ident{Name: "use_repo_rule"},
+					List: []build.Expr{NewStringExpr(gazelleDeps), NewStringExpr("go_repository")},
+				},
+			})
+		}
+		f.Stmt = appendStmt(f.Stmt, rule.Call)
+		return rule
+	}
+
+	macro := repositoryMacro(f)
+	if macro == nil {
+		f.Stmt = edit.InsertLoad(f.Stmt, gazelleDeps, []string{"go_repository"}, []string{"go_repository"})
+		macro = &build.DefStmt{Name: bazelMacro}
+		f.Stmt = append(f.Stmt, macro)
+	}
+	macro.Body = appendStmt(macro.Body, rule.Call)
+	return rule
+}
+
+// appendStmt appends a new statement a line below the last one. Outside of BUILD files, the formatter only separates
+// statements with a blank line if they were separated in the original file, so this keeps the rules apart.
+func appendStmt(stmts []build.Expr, stmt build.Expr) []build.Expr {
+	line := 1
+	if len(stmts) > 0 {
+		_, end := stmts[len(stmts)-1].Span()
+		line = end.Line + 2
+	}
+	setLine(stmt, line)
+	return append(stmts, stmt)
+}
+
+// setLine sets the position of a new statement to the line. Multi-line calls end with the closing bracket on its own
+// line, after their arguments.
+func setLine(stmt build.Expr, line int) {
+	switch x := stmt.(type) {
+	case *build.Ident:
+		x.NamePos.Line = line
+	case *build.AssignExpr:
+		setLine(x.LHS, line)
+		setLine(x.RHS, line)
+	case *build.CallExpr:
+		setLine(x.X, line)
+		x.ListStart.Line = line
+		x.End.Pos.Line = line
+		if x.ForceMultiLine {
+			x.End.Pos.Line = line + len(x.List) + 1
+		}
+	}
+}
+
+// repositoryMacro returns the macro in a .bzl file that new go_repository() rules are added to. This is the macro that
+// contains the existing rules, or go_dependencies() if there aren't any.
+func repositoryMacro(f *build.File) *build.DefStmt {
+	var ret *build.DefStmt
+	for _, stmt := range f.Stmt {
+		def, ok := stmt.(*build.DefStmt)
+		if !ok {
+			continue
+		}
+		for _, expr := range def.Body {
+			if call, ok := expr.(*build.CallExpr); ok && f.Rule(call).Kind() == "go_repository" {
+				return def
+			}
+		}
+		if def.Name == bazelMacro {
+			ret = def
+		}
+	}
+	return ret
+}
+
+// definesRepositoryRule returns true if the file assigns go_repository e.g. with use_repo_rule() in MODULE.bazel
+func definesRepositoryRule(f *build.File) bool {
+	for _, stmt := range f.Stmt {
+		if assign, ok := stmt.(*build.AssignExpr); ok {
+			if ident, ok := assign.LHS.(*build.Ident); ok && ident.Name == "go_repository" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// repositoryName returns the name of the go_repository() rule for the module. New rules follow Gazelle's convention of
+// reversing the domain and replacing the separators with underscores e.g. github.com/foo/bar-baz ->
+// com_github_foo_bar_baz.
+func (file *BuildFile) repositoryName(m *model.Module) string {
+	if name, ok := file.moduleNames[m]; ok {
+		return name
+	}
+
+	parts := strings.Split(strings.ToLower(m.Name), "/")
+	domain := strings.Split(parts[0], ".")
+	for l, r := 0, len(domain)-1; l < r; l, r = l+1, r-1 {
+		domain[l], domain[r] = domain[r], domain[l]
+	}
+	base := strings.NewReplacer("-", "_", ".", "_").Replace(strings.Join(append(domain, parts[1:]...), "_"))
+
+	name := base
+	for i := 1; ; i++ {
+		if extant, ok := file.usedNames[name]; !ok || extant == m.Name {
+			break
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	file.usedNames[name] = m.Name
+	file.moduleNames[m] = name
+	return name
+}
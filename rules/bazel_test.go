@@ -0,0 +1,102 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/buildtools/build"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/resolve"
+)
+
+// readBazelGraph writes the file to a temporary directory and reads it into a new graph using the Bazel backend
+func readBazelGraph(t *testing.T, name, contents string) (*BuildGraph, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+
+	g := NewGraph("BUILD")
+	g.Backend = &BazelBackend{Path: path}
+	require.NoError(t, g.ReadRules(path))
+	return g, path
+}
+
+func TestBazelUpdatesDepsBzl(t *testing.T) {
+	g, path := readBazelGraph(t, "deps.bzl", `load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+def go_dependencies():
+    # Pinned for the old API
+    go_repository(
+        name = "com_github_example_foo",
+        importpath = "github.com/example/foo",
+        sum = "h1:abc=",
+        version = "v1.0.0",
+    )
+
+    go_repository(
+        name = "com_github_example_bar",
+        importpath = "github.com/example/bar",
+        sum = "h1:def=",
+        version = "v1.0.0",
+    )
+`)
+	foo := g.Modules.GetModule(resolve.ModuleKey{Path: "github.com/example/foo"})
+	require.Equal(t, "v1.0.0", foo.Version)
+	foo.Version = "v1.1.0"
+	foo.Parts[0].Modified = true
+
+	baz := g.Modules.GetModule(resolve.ModuleKey{Path: "gopkg.in/baz-qux.v2", Replace: "github.com/fork/baz"})
+	baz.Version = "v2.0.1"
+	addPart(g, baz, ".")
+
+	require.NoError(t, g.Update(false, ""))
+
+	require.Equal(t, `load("@bazel_gazelle//:deps.bzl", "go_repository")
+
+def go_dependencies():
+    # Pinned for the old API
+    go_repository(
+        name = "com_github_example_foo",
+        importpath = "github.com/example/foo",
+        version = "v1.1.0",
+    )
+
+    go_repository(
+        name = "com_github_example_bar",
+        importpath = "github.com/example/bar",
+        sum = "h1:def=",
+        version = "v1.0.0",
+    )
+
+    go_repository(
+        name = "in_gopkg_baz_qux_v2",
+        importpath = "gopkg.in/baz-qux.v2",
+        replace = "github.com/fork/baz",
+        version = "v2.0.1",
+    )
+`, string(build.Format(g.Files[path].File)))
+}
+
+func TestBazelCreatesModuleFile(t *testing.T) {
+	g, path := readBazelGraph(t, "MODULE.bazel", `module(name = "example")
+`)
+	m := g.Modules.GetModule(resolve.ModuleKey{Path: "golang.org/x/net"})
+	m.Version = "v0.1.0"
+	addPart(g, m, "http2")
+
+	require.NoError(t, g.Update(false, ""))
+
+	require.Equal(t, `module(name = "example")
+
+go_repository = use_repo_rule("@bazel_gazelle//:deps.bzl", "go_repository")
+
+go_repository(
+    name = "org_golang_x_net",
+    importpath = "golang.org/x/net",
+    version = "v0.1.0",
+)
+`, string(build.Format(g.Files[path].File)))
+}
@@ -0,0 +1,91 @@
+package rules
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/buildtools/build"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Diff writes a unified diff between the BUILD files on disk and what would be written, for the files that would
+// change. Files that would be created are diffed against /dev/null, as are those that would be deleted. It returns
+// whether any files would change.
+func (g *BuildGraph) Diff(w io.Writer) (bool, error) {
+	removed := make([]string, 0, len(g.removedFiles))
+	for path := range g.removedFiles {
+		removed = append(removed, path)
+	}
+	sort.Strings(removed)
+
+	changed := false
+	for _, path := range removed {
+		before, exists, err := readExisting(path)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			continue
+		}
+		if err := writeDiff(w, path, before, nil, true, false); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	for _, f := range g.sortedFiles() {
+		before, exists, err := readExisting(f.File.Path)
+		if err != nil {
+			return false, err
+		}
+		after := build.Format(f.File)
+		if exists && bytes.Equal(before, after) {
+			continue
+		}
+		if err := writeDiff(w, f.File.Path, before, after, exists, true); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// readExisting reads the file at the path, returning false if it doesn't exist
+func readExisting(path string) ([]byte, bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+// writeDiff writes a unified diff of a file in the format git uses, so it can be applied with git apply or patch -p1
+func writeDiff(w io.Writer, path string, before, after []byte, existed, exists bool) error {
+	diff := difflib.UnifiedDiff{
+		A:        splitLines(before),
+		B:        splitLines(after),
+		FromFile: "a/" + path,
+		ToFile:   "b/" + path,
+		Context:  3,
+	}
+	if !existed {
+		diff.FromFile = "/dev/null"
+	}
+	if !exists {
+		diff.ToFile = "/dev/null"
+	}
+	return difflib.WriteUnifiedDiff(w, diff)
+}
+
+// splitLines splits the data into lines, keeping the line endings. Unlike difflib.SplitLines, this doesn't add an empty
+// line to the end, which would stop the diff applying.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,56 @@
+package rules
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/resolve"
+)
+
+func TestDiff(t *testing.T) {
+	g, dir := readGraph(t, `go_module(
+    name = "foo",
+    install = ["a"],
+    module = "example.com/foo",
+    version = "v1.0.0",
+    visibility = ["PUBLIC"],
+)
+`)
+	path := filepath.Join(dir, "BUILD")
+
+	// Nothing has changed yet
+	buf := new(strings.Builder)
+	changed, err := g.Diff(buf)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Empty(t, buf.String())
+
+	m := g.Modules.Mods[resolve.ModuleKey{Path: "example.com/foo"}]
+	m.Version = "v1.1.0"
+	m.Parts[0].Modified = true
+	require.NoError(t, g.Update(false, dir))
+
+	changed, err = g.Diff(buf)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, `--- a/`+path+`
++++ b/`+path+`
+@@ -2,6 +2,6 @@
+     name = "foo",
+     install = ["a"],
+     module = "example.com/foo",
+-    version = "v1.0.0",
++    version = "v1.1.0",
+     visibility = ["PUBLIC"],
+ )
+`, buf.String())
+
+	// Once the rules have been written, there's nothing left to change
+	require.NoError(t, g.Write(true))
+	changed, err = g.Diff(new(strings.Builder))
+	require.NoError(t, err)
+	require.False(t, changed)
+}
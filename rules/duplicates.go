@@ -0,0 +1,167 @@
+package rules
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/tatskaari/go-deps/resolve/model"
+)
+
+// Duplicate is a module that was defined in more than one BUILD file, and has been merged into one of them
+type Duplicate struct {
+	Module string
+	// The file the module's rules were kept in
+	Kept string
+	// The files the module's rules were removed from
+	Removed []string
+}
+
+// Layout works out which layout the third party rules are in. They're structured if most of the modules are defined
+// outside the top level BUILD file in the third party folder. If modules are defined in both, mixed is true.
+func (g *BuildGraph) Layout(thirdPartyFolder string) (structured, mixed bool) {
+	topLevel := filepath.Join(thirdPartyFolder, g.BuildFileName)
+
+	flat, nested := 0, 0
+	for _, file := range g.Files {
+		modules := map[*model.Module]struct{}{}
+		for part := range file.ModRules {
+			modules[part.Module] = struct{}{}
+		}
+		if filepath.Clean(file.File.Path) == topLevel {
+			flat += len(modules)
+		} else {
+			nested += len(modules)
+		}
+	}
+	return nested > flat, flat > 0 && nested > 0
+}
+
+// MergeDuplicates merges the modules that are defined in more than one BUILD file into one of them. The rules are kept
+// in the file the module belongs in for the layout, or the file with the module's namesake if none of them are. The
+// packages the other rules install are added to the namesake, and the rules are replaced with aliases to it. The
+// version in the file that's kept wins.
+func (g *BuildGraph) MergeDuplicates(structured bool, thirdPartyFolder string) []Duplicate {
+	var ret []Duplicate
+	for _, m := range g.Modules.SortedMods() {
+		files := g.moduleFiles(m)
+		if len(files) < 2 || len(m.Parts) == 0 {
+			continue
+		}
+
+		path := filepath.Join(thirdPartyFolder, g.BuildFileName)
+		if structured {
+			path = filepath.Join(thirdPartyFolder, m.Name, g.BuildFileName)
+		}
+		keep := g.partFile(m.Parts[len(m.Parts)-1])
+		for _, file := range files {
+			if filepath.Clean(file.File.Path) == path && len(file.moduleParts(m)) > 0 {
+				keep = file
+			}
+		}
+
+		parts := keep.moduleParts(m)
+		namesake := parts[len(parts)-1]
+		to := absoluteLabel(keep.pkg(), ":"+keep.ModRules[namesake].Name())
+
+		dup := Duplicate{Module: m.Name, Kept: keep.File.Path}
+		removed := map[string]struct{}{}
+		for _, part := range m.Parts {
+			file := g.partFile(part)
+			if file == keep {
+				continue
+			}
+			rule := file.ModRules[part]
+
+			for pkg := range part.Packages {
+				namesake.Packages[pkg] = struct{}{}
+				g.Modules.ImportPaths[pkg] = namesake
+			}
+			for _, i := range part.InstallWildCards {
+				if !contains(namesake.InstallWildCards, i) {
+					namesake.InstallWildCards = append(namesake.InstallWildCards, i)
+				}
+			}
+			namesake.Modified = true
+
+			file.File.DelRules("", rule.Name())
+			alias := newAlias(file.File, rule.Name(), relativeLabel(file.pkg(), to))
+			alias.Call.Comments.Before = append(rule.Call.Comments.Before, alias.Call.Comments.Before...)
+			g.renames[absoluteLabel(file.pkg(), ":"+rule.Name())] = to
+
+			delete(file.ModRules, part)
+			delete(file.partNames, part)
+			delete(file.moduleNames, m)
+			removed[file.File.Path] = struct{}{}
+		}
+		for _, file := range files {
+			if file == keep {
+				continue
+			}
+			if dlRule, ok := file.ModDownloadRules[m]; ok {
+				file.File.DelRules("", dlRule.Name())
+				delete(file.ModDownloadRules, m)
+				delete(file.downloadNames, m)
+				removed[file.File.Path] = struct{}{}
+			}
+		}
+
+		for i, part := range parts {
+			part.Index = i + 1
+		}
+		m.Parts = parts
+		g.ModFiles[m] = keep
+		if dlRule, ok := keep.ModDownloadRules[m]; ok {
+			m.Version = dlRule.AttrString("version")
+		} else {
+			m.Version = keep.ModRules[namesake].AttrString("version")
+		}
+
+		for path := range removed {
+			dup.Removed = append(dup.Removed, path)
+		}
+		sort.Strings(dup.Removed)
+		ret = append(ret, dup)
+	}
+	return ret
+}
+
+// moduleFiles returns the files that have rules for the module, sorted by their path
+func (g *BuildGraph) moduleFiles(m *model.Module) []*BuildFile {
+	var ret []*BuildFile
+	for _, file := range g.sortedFiles() {
+		if _, ok := file.ModDownloadRules[m]; ok || len(file.moduleParts(m)) > 0 {
+			ret = append(ret, file)
+		}
+	}
+	return ret
+}
+
+// moduleParts returns the parts of the module that have rules in this file, in order
+func (file *BuildFile) moduleParts(m *model.Module) []*model.ModulePart {
+	var ret []*model.ModulePart
+	for _, part := range m.Parts {
+		if _, ok := file.ModRules[part]; ok {
+			ret = append(ret, part)
+		}
+	}
+	return ret
+}
+
+// partFile returns the file that has the rule for the module part
+func (g *BuildGraph) partFile(part *model.ModulePart) *BuildFile {
+	for _, file := range g.Files {
+		if _, ok := file.ModRules[part]; ok {
+			return file
+		}
+	}
+	return nil
+}
+
+func contains(ss []string, s string) bool {
+	for _, i := range ss {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package rules
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bazelbuild/buildtools/build"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/resolve"
+)
+
+func TestMergeDuplicates(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "third_party/go/BUILD", `go_module(
+    name = "foo",
+    install = ["b"],
+    module = "example.com/foo",
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "bar",
+    module = "example.com/bar",
+    version = "v1.0.0",
+    deps = [":foo"],
+)
+`)
+	writeFile(t, root, "third_party/go/example.com/foo/BUILD", `go_module(
+    name = "foo",
+    install = ["a"],
+    module = "example.com/foo",
+    version = "v1.1.0",
+    visibility = ["PUBLIC"],
+)
+`)
+
+	// Labels are relative to the repo root, which is the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	g := NewGraph("BUILD")
+	require.NoError(t, g.ReadRules("third_party/go/BUILD"))
+	require.NoError(t, g.ReadRules("third_party/go/example.com/foo/BUILD"))
+
+	structured, mixed := g.Layout("third_party/go")
+	require.False(t, structured)
+	require.True(t, mixed)
+
+	duplicates := g.MergeDuplicates(true, "third_party/go")
+	require.Equal(t, []Duplicate{{
+		Module:  "example.com/foo",
+		Kept:    "third_party/go/example.com/foo/BUILD",
+		Removed: []string{"third_party/go/BUILD"},
+	}}, duplicates)
+
+	foo := g.Modules.GetModule(resolve.ModuleKey{Path: "example.com/foo"})
+	require.Equal(t, "v1.1.0", foo.Version)
+	require.Len(t, foo.Parts, 1)
+	require.Equal(t, foo.Parts[0], g.Modules.Provider("example.com/foo/a"))
+	require.Equal(t, foo.Parts[0], g.Modules.Provider("example.com/foo/b"))
+	require.Equal(t, "//third_party/go/example.com/foo:foo", g.PartLabel(foo.Parts[0]))
+
+	flat := g.Files["third_party/go/BUILD"].File
+	require.Equal(t, []string{"foo"}, ruleNames(flat, "filegroup"))
+	require.Equal(t, `["//third_party/go/example.com/foo:foo"]`, build.FormatString(flat.Rules("filegroup")[0].Attr("exported_deps")))
+	require.Equal(t, "//third_party/go/example.com/foo:foo", g.renames["//third_party/go:foo"])
+}
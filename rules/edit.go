@@ -0,0 +1,131 @@
+package rules
+
+import (
+	"os"
+	"strings"
+
+	"github.com/bazelbuild/buildtools/build"
+
+	"github.com/tatskaari/go-deps/journal"
+)
+
+// manualComment marks entries in the lists go-deps generates that have been added by hand, and should be kept
+const manualComment = "# manual"
+
+// isManual returns true if the list entry has been marked as manual with a comment before or after it
+func isManual(expr build.Expr) bool {
+	comments := expr.Comment()
+	for _, c := range append(append([]build.Comment{}, comments.Before...), comments.Suffix...) {
+		if strings.HasPrefix(strings.TrimSpace(c.Token), manualComment) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasManualEntries returns true if any of the entries in the list attribute are marked as manual
+func hasManualEntries(rule *build.Rule, attr string) bool {
+	list, ok := rule.Attr(attr).(*build.ListExpr)
+	if !ok {
+		return false
+	}
+	for _, expr := range list.List {
+		if isManual(expr) {
+			return true
+		}
+	}
+	return false
+}
+
+// setAttr sets the attribute on the rule, keeping any comments on its old value
+func setAttr(rule *build.Rule, key string, val build.Expr) {
+	if old := rule.Attr(key); old != nil {
+		*val.Comment() = *old.Comment()
+	}
+	rule.SetAttr(key, val)
+}
+
+// mergeList sets the list attribute on the rule to the computed values. Entries that have been marked as manual, or
+// aren't plain strings, are kept. The existing entries are reused where they're still needed, so their comments are
+// kept too. If the list ends up empty, the attribute is removed.
+func mergeList(rule *build.Rule, attr string, values []string) {
+	list, isList := rule.Attr(attr).(*build.ListExpr)
+	if rule.Attr(attr) != nil && !isList {
+		// This has been set to something we don't understand e.g. a variable, so leave it alone
+		return
+	}
+
+	existing := map[string]build.Expr{}
+	var kept []build.Expr
+	if list != nil {
+		for _, expr := range list.List {
+			str, ok := expr.(*build.StringExpr)
+			if !ok {
+				kept = append(kept, expr)
+				continue
+			}
+			existing[str.Value] = expr
+			if isManual(expr) {
+				kept = append(kept, expr)
+			}
+		}
+	}
+
+	newList := make([]build.Expr, 0, len(values)+len(kept))
+	done := map[build.Expr]struct{}{}
+	for _, v := range values {
+		expr, ok := existing[v]
+		if !ok {
+			expr = NewStringExpr(v)
+		}
+		if _, ok := done[expr]; ok {
+			continue
+		}
+		done[expr] = struct{}{}
+		newList = append(newList, expr)
+	}
+	for _, expr := range kept {
+		if _, ok := done[expr]; !ok {
+			newList = append(newList, expr)
+		}
+	}
+
+	switch {
+	case len(newList) == 0:
+		rule.DelAttr(attr)
+	case list != nil:
+		list.List = newList
+	default:
+		rule.SetAttr(attr, &build.ListExpr{List: newList})
+	}
+}
+
+// SetFilegroup adds a public filegroup() with the srcs to the BUILD file, creating the file if it doesn't exist yet. If
+// there's already a filegroup() with that name, its srcs are updated. The file is backed up to the journal, which can be
+// nil, before it's changed.
+func SetFilegroup(j *journal.Journal, path, name string, srcs ...string) error {
+	f := &build.File{Path: path, Type: build.TypeBuild}
+	if data, err := os.ReadFile(path); err == nil {
+		if f, err = build.ParseBuild(path, data); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var rule *build.Rule
+	for _, r := range f.Rules("filegroup") {
+		if r.Name() == name {
+			rule = r
+		}
+	}
+	if rule == nil {
+		rule = NewRule(f, "filegroup", name)
+		rule.SetAttr("visibility", NewStringList("PUBLIC"))
+	}
+	mergeList(rule, "srcs", srcs)
+
+	tx := journal.NewTransaction(j)
+	tx.WriteFile(path, build.Format(f), 0644)
+	return tx.Commit()
+}
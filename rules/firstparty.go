@@ -0,0 +1,204 @@
+package rules
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/buildtools/build"
+
+	"github.com/tatskaari/go-deps/journal"
+	"github.com/tatskaari/go-deps/resolve/knownimports"
+	"github.com/tatskaari/go-deps/resolve/model"
+	"github.com/tatskaari/go-deps/scan"
+)
+
+// goRuleKinds are the first party rules that we update the deps of
+var goRuleKinds = map[string]struct{}{
+	"go_library": {},
+	"go_binary":  {},
+	"go_test":    {},
+}
+
+// DepChange describes how the deps of a first party rule were changed to match the imports of its sources
+type DepChange struct {
+	Label   string
+	Added   []string
+	Removed []string
+	// Any third party imports that aren't provided by a go_module() rule
+	Missing []string
+	// Set if the rule's sources couldn't be determined, so its deps were left alone
+	Skipped bool
+}
+
+// SyncFirstPartyDeps updates the deps of the go_library(), go_binary() and go_test() rules in the BUILD files under root
+// to match the third party packages their sources import. Each import is mapped to the go_module() rule for the module
+// that installs it. Deps on go_module() rules that are no longer imported are removed. Any other deps, and the rest
+// of the rule, are left untouched. The files are only written back if write is true.
+func (g *BuildGraph) SyncFirstPartyDeps(root, thirdPartyFolder, modulePath string, structured, write bool) ([]DepChange, error) {
+	parts := g.PartsByLabel()
+
+	var tx *journal.Transaction
+	if write {
+		tx = journal.NewTransaction(g.Journal)
+	}
+
+	var changes []DepChange
+	err := g.editFirstPartyFiles(root, thirdPartyFolder, tx, func(pkg string, f *build.File) (bool, error) {
+		changed := false
+		for _, rule := range f.Rules("") {
+			if _, ok := goRuleKinds[rule.Kind()]; !ok {
+				continue
+			}
+
+			change := DepChange{Label: "//" + pkg + ":" + rule.Name()}
+			srcs, ok := literalStrings(rule.Attr("srcs"))
+			if !ok {
+				change.Skipped = true
+				changes = append(changes, change)
+				continue
+			}
+
+			var imports []string
+			for _, src := range srcs {
+				if filepath.Ext(src) != ".go" {
+					continue
+				}
+				fileImports, err := scan.FileImports(filepath.Join(root, pkg, src))
+				if err != nil {
+					return false, err
+				}
+				imports = append(imports, fileImports...)
+			}
+
+			g.syncRuleDeps(pkg, rule, imports, parts, thirdPartyFolder, modulePath, structured, &change)
+			if len(change.Added)+len(change.Removed)+len(change.Missing) > 0 {
+				changes = append(changes, change)
+			}
+			changed = changed || len(change.Added)+len(change.Removed) > 0
+		}
+		return changed, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return changes, nil
+}
+
+// syncRuleDeps updates the deps of the rule to depend on the modules that provide the imports. New deps are on the
+// namesake of the module, unless it doesn't have a rule, in which case they're on the part that provides the import.
+func (g *BuildGraph) syncRuleDeps(pkg string, rule *build.Rule, imports []string, parts map[string]*model.ModulePart, thirdPartyFolder, modulePath string, structured bool, change *DepChange) {
+	needed := map[*model.ModulePart]struct{}{}
+	neededModules := map[*model.Module]struct{}{}
+	missing := map[string]struct{}{}
+	for _, i := range imports {
+		if knownimports.IsInGoRoot(i) || scan.IsFirstParty(i, modulePath) {
+			continue
+		}
+		part := g.Modules.Provider(i)
+		if part == nil {
+			missing[i] = struct{}{}
+			continue
+		}
+		needed[part] = struct{}{}
+		neededModules[part.Module] = struct{}{}
+	}
+	for i := range missing {
+		change.Missing = append(change.Missing, i)
+	}
+	sort.Strings(change.Missing)
+
+	// Work out which of the existing deps on go_module() rules are still used. The namesake exports the rest of the
+	// parts of its module, so a dep on that satisfies any import from the module.
+	satisfied := map[*model.ModulePart]struct{}{}
+	list, _ := rule.Attr("deps").(*build.ListExpr)
+	if list != nil {
+		newList := make([]build.Expr, 0, len(list.List))
+		for _, expr := range list.List {
+			str, ok := expr.(*build.StringExpr)
+			if !ok {
+				newList = append(newList, expr)
+				continue
+			}
+			part, ok := parts[absoluteLabel(pkg, str.Value)]
+			if !ok {
+				newList = append(newList, expr)
+				continue
+			}
+
+			_, used := needed[part]
+			if part.Index == len(part.Module.Parts) {
+				if _, ok := neededModules[part.Module]; ok {
+					used = true
+					for _, p := range part.Module.Parts {
+						satisfied[p] = struct{}{}
+					}
+				}
+			}
+			if !used {
+				change.Removed = append(change.Removed, str.Value)
+				continue
+			}
+			satisfied[part] = struct{}{}
+			newList = append(newList, expr)
+		}
+		list.List = newList
+	}
+
+	var added []string
+	for part := range needed {
+		if _, ok := satisfied[part]; ok {
+			continue
+		}
+		file, ok := g.ModFiles[part.Module]
+		if !ok {
+			continue
+		}
+		// Depend on the namesake, which exports the rest of the parts, so the dep doesn't change when the module is split
+		// differently
+		if namesake := part.Module.Parts[len(part.Module.Parts)-1]; file.ModRules[namesake] != nil {
+			part = namesake
+			for _, p := range part.Module.Parts {
+				satisfied[p] = struct{}{}
+			}
+		}
+		label := thirdPartyLabel(file.partName(part, structured), part.Module.Name, thirdPartyFolder, structured)
+		added = append(added, shortLabel(pkg, label, true))
+	}
+	sort.Strings(added)
+	change.Added = added
+
+	if len(added) > 0 {
+		if list == nil {
+			list = NewStringList()
+			rule.SetAttr("deps", list)
+		}
+		for _, dep := range added {
+			list.List = append(list.List, NewStringExpr(dep))
+		}
+	}
+	if list != nil && len(list.List) == 0 && len(change.Removed) > 0 {
+		rule.DelAttr("deps")
+	}
+}
+
+// literalStrings returns the values of a list of strings, or false if the expression is anything else e.g. a glob()
+func literalStrings(expr build.Expr) ([]string, bool) {
+	list, ok := expr.(*build.ListExpr)
+	if !ok {
+		return nil, false
+	}
+	ret := make([]string, 0, len(list.List))
+	for _, i := range list.List {
+		str, ok := i.(*build.StringExpr)
+		if !ok {
+			return nil, false
+		}
+		ret = append(ret, str.Value)
+	}
+	return ret, true
+}
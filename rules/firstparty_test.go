@@ -0,0 +1,107 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncFirstPartyDeps(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "third_party/go/BUILD", `
+go_module(
+    name = "foo_1a2b3c4",
+    module = "example.com/foo",
+    install = ["b"],
+)
+
+go_module(
+    name = "foo",
+    module = "example.com/foo",
+    install = ["a"],
+    exported_deps = [":foo_1a2b3c4"],
+)
+
+go_module(
+    name = "bar",
+    module = "example.com/bar",
+)
+
+go_module(
+    name = "baz",
+    module = "example.com/baz",
+)
+`)
+	writeFile(t, root, "src/src.go", `package src
+
+import (
+	"fmt"
+
+	"example.com/bar"
+	"example.com/foo/b"
+	"example.com/missing"
+	"github.com/example/repo/src/other"
+)
+`)
+	writeFile(t, root, "src/BUILD", `go_library(
+    name = "src",
+    srcs = ["src.go"],
+    visibility = ["PUBLIC"],
+    deps = [
+        ":other",
+        "//third_party/go:baz",
+    ],
+)
+
+go_test(
+    name = "src_test",
+    srcs = glob(["*_test.go"]),
+)
+`)
+
+	// Labels are relative to the repo root, which is the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	g := NewGraph("BUILD")
+	require.NoError(t, g.ReadRules("third_party/go/BUILD"))
+
+	// foo/b is installed by foo_1a2b3c4, but the dep is added on the namesake, which exports it
+	changes, err := g.SyncFirstPartyDeps(".", "third_party/go", "github.com/example/repo", false, true)
+	require.NoError(t, err)
+	require.Equal(t, []DepChange{
+		{
+			Label:   "//src:src",
+			Added:   []string{"//third_party/go:bar", "//third_party/go:foo"},
+			Removed: []string{"//third_party/go:baz"},
+			Missing: []string{"example.com/missing"},
+		},
+		{
+			Label:   "//src:src_test",
+			Skipped: true,
+		},
+	}, changes)
+
+	data, err := os.ReadFile(filepath.Join(root, "src/BUILD"))
+	require.NoError(t, err)
+	require.Equal(t, `go_library(
+    name = "src",
+    srcs = ["src.go"],
+    visibility = ["PUBLIC"],
+    deps = [
+        ":other",
+        "//third_party/go:bar",
+        "//third_party/go:foo",
+    ],
+)
+
+go_test(
+    name = "src_test",
+    srcs = glob(["*_test.go"]),
+)
+`, string(data))
+}
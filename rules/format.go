@@ -1,13 +1,17 @@
 package rules
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"golang.org/x/tools/go/packages"
-	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/tatskaari/go-deps/journal"
+	"github.com/tatskaari/go-deps/licence"
 	resolve "github.com/tatskaari/go-deps/resolve/model"
 
 	"github.com/bazelbuild/buildtools/build"
@@ -48,21 +52,90 @@ func (file *BuildFile) assignName(mod *resolve.Module, suffix string, structured
 	return name
 }
 
-func (file *BuildFile) partName(part *resolve.ModulePart, structured bool) string {
-	if name, ok := file.partNames[part]; ok {
+// moduleName returns the name of the namesake rule for the module i.e. the go_module() rule other rules depend on for
+// this module. Once a module has a name, it keeps it.
+func (file *BuildFile) moduleName(mod *resolve.Module, structured bool) string {
+	if name, ok := file.moduleNames[mod]; ok {
 		return name
 	}
-	displayIndex := len(part.Module.Parts) - part.Index
-	suffix := ""
-	if displayIndex > 0 {
-		suffix = fmt.Sprintf("_%d", displayIndex)
+	name := file.assignName(mod, "", structured)
+	file.moduleNames[mod] = name
+	return name
+}
+
+// partName returns the name of the rule for the module part. The last part is the namesake of the module, and exports
+// the rest of the parts, so it's always named after the module. The other parts are named after the module and a hash of
+// the packages they install, so the name is stable across runs, and doesn't change as other parts are added to the
+// module. Once a part has a name, it keeps it, unless it becomes or stops being the namesake. See renamePart.
+func (file *BuildFile) partName(part *resolve.ModulePart, structured bool) string {
+	moduleName := file.moduleName(part.Module, structured)
+	namesake := part.Index == len(part.Module.Parts)
+	if name, ok := file.partNames[part]; ok && (name == moduleName) == namesake {
+		return name
 	}
 
-	name := file.assignName(part.Module, suffix, structured)
+	name := moduleName
+	if !namesake {
+		name = moduleName + "_" + partHash(part)
+		for i := 1; ; i++ {
+			if _, ok := file.usedNames[name]; !ok {
+				break
+			}
+			name = fmt.Sprintf("%s_%s_%d", moduleName, partHash(part), i)
+		}
+		file.usedNames[name] = part.Module.Name
+	}
 	file.partNames[part] = name
 	return name
 }
 
+// renamePart renames the rule for the part if it's become, or stopped being, the namesake of the module. The module's
+// name stays on the part that exports the rest, so references to it still get the whole module. Any other name that's
+// given up is left as an alias to the new one.
+func (g *BuildGraph) renamePart(file *BuildFile, part *resolve.ModulePart, rule *build.Rule, structured bool) {
+	oldName := rule.Name()
+	name := file.partName(part, structured)
+	if oldName == name {
+		return
+	}
+	setAttr(rule, "name", NewStringExpr(name))
+	if oldName == file.moduleName(part.Module, structured) {
+		return
+	}
+	g.renames[absoluteLabel(file.pkg(), ":"+oldName)] = absoluteLabel(file.pkg(), ":"+name)
+	newAlias(file.File, oldName, ":"+name)
+}
+
+// updateLicences sets the licences of the rule to the ones detected for the module, keeping any marked "# manual". The
+// rule is left alone if the licence wasn't detected.
+func updateLicences(rule *build.Rule, m *resolve.Module) {
+	if m.Licence != "" {
+		mergeList(rule, "licences", licence.Alternatives(m.Licence))
+	}
+}
+
+// partHash returns a short hash of what the module part installs
+func partHash(part *resolve.ModulePart) string {
+	installs := make([]string, 0, len(part.Packages)+len(part.InstallWildCards))
+	for _, i := range part.InstallWildCards {
+		installs = append(installs, wildcardInstall(i))
+	}
+	for _, pkg := range part.SortedPackages() {
+		if !part.IsWildcardImport(pkg) {
+			installs = append(installs, toInstall(pkg))
+		}
+	}
+	sort.Strings(installs)
+
+	h := sha1.New()
+	h.Write([]byte(part.Module.Name))
+	for _, i := range installs {
+		h.Write([]byte{0})
+		h.Write([]byte(i))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:7]
+}
+
 func (file *BuildFile) downloadRuleName(module *resolve.Module, structured bool) string {
 	if name, ok := file.downloadNames[module]; ok {
 		return name
@@ -72,6 +145,14 @@ func (file *BuildFile) downloadRuleName(module *resolve.Module, structured bool)
 	return name
 }
 
+// wildcardInstall returns the install entry for a wildcard install of the packages under the path
+func wildcardInstall(path string) string {
+	if path == "" || path == "." {
+		return "..."
+	}
+	return path + "/..."
+}
+
 func toInstall(pkg *packages.Package) string {
 	install := strings.Trim(strings.TrimPrefix(pkg.ID, pkg.Module.Path), "/")
 	if install == "" {
@@ -93,7 +174,7 @@ func (g *BuildGraph) file(mod *resolve.Module, structured bool, thirdPartyFolder
 		return f, nil
 	} else {
 		// TODO create the build file
-		file, err := newFile(path)
+		file, err := g.newFile(path)
 		if err != nil {
 			return nil, err
 		}
@@ -110,17 +191,44 @@ func cannonicalise(name, modpath, thirdParty string, structured bool) string {
 		return ":" + name
 	}
 
+	return thirdPartyLabel(name, modpath, thirdParty, structured)
+}
+
+// thirdPartyLabel returns the fully qualified label of a rule for the module, for use outside of the third party folder
+func thirdPartyLabel(name, modpath, thirdParty string, structured bool) string {
+	if !structured {
+		return "//" + filepath.Clean(thirdParty) + ":" + name
+	}
 	return "//" + filepath.Join(thirdParty, modpath) + ":" + name
 }
 
+// Format updates the rules for the modules that have been modified, and then writes them out. See Update and Write.
 func (g *BuildGraph) Format(structured, write bool, thirdPartyFolder string) error {
-	for _, m := range g.Modules.Mods {
+	if err := g.Update(structured, thirdPartyFolder); err != nil {
+		return err
+	}
+	return g.Write(write)
+}
+
+// Update updates the rules for the modules that have been modified using the graph's backend. The rules are merged with
+// what's already there: computed values are updated, but entries in computed lists that are marked with a "# manual"
+// comment, attributes we don't set, and comments are kept.
+func (g *BuildGraph) Update(structured bool, thirdPartyFolder string) error {
+	return g.Backend.Update(g, structured, thirdPartyFolder)
+}
+
+// Update updates the go_module() or go_repo() rules for the modules. Visibility is only set if the rule doesn't have it
+// already. The licences of the modules that were modified are refreshed, keeping any entries marked "# manual".
+func (PleaseBackend) Update(g *BuildGraph, structured bool, thirdPartyFolder string) error {
+	g.removeMergedParts(structured)
+
+	for _, m := range g.Modules.SortedMods() {
 		file, err := g.file(m, structured, thirdPartyFolder)
 		if err != nil {
 			return err
 		}
 		dlRule, ok := file.ModDownloadRules[m]
-		if len(m.Parts) > 1 || m.ReplacedBy != "" {
+		if m.ReplacedBy != "" || (!g.GoRepo && len(m.Parts) > 1) {
 			if !ok {
 				dlRule = NewRule(file.File, "go_mod_download", file.downloadRuleName(m, structured))
 				file.ModDownloadRules[m] = dlRule
@@ -131,40 +239,49 @@ func (g *BuildGraph) Format(structured, write bool, thirdPartyFolder string) err
 				name = m.ReplacedBy
 			}
 
-			dlRule.SetAttr("module", NewStringExpr(name))
+			setAttr(dlRule, "module", NewStringExpr(name))
 			if m.Version != "" {
-				dlRule.SetAttr("version", NewStringExpr(version))
+				g.updateVersion(file, dlRule, version, m.IsModified())
+			}
+			if m.IsModified() || dlRule.Attr("licences") == nil {
+				updateLicences(dlRule, m)
 			}
-			if m.Licence != "" {
-				dlRule.SetAttr("licences", NewStringList(m.Licence))
+		}
+
+		if g.GoRepo {
+			if m.IsModified() {
+				g.updateGoRepo(file, m, dlRule, structured)
 			}
+			continue
 		}
 
 		for _, part := range m.Parts {
+			modRule, ok := file.ModRules[part]
+			if ok {
+				g.renamePart(file, part, modRule, structured)
+			}
 			if !part.Modified {
 				continue
 			}
-			modRule, ok := file.ModRules[part]
 			if !ok {
 				modRule = NewRule(file.File, "go_module", file.partName(part, structured))
 				file.ModRules[part] = modRule
 			}
-			modRule.DelAttr("install")
-			modRule.DelAttr("deps")
-			modRule.DelAttr("exported_deps")
-			modRule.DelAttr("visibility")
 
-			modRule.SetAttr("module", NewStringExpr(m.Name))
+			setAttr(modRule, "module", NewStringExpr(m.Name))
 
 			if dlRule != nil {
+				// The go_mod_download() rule downloads the module now, so the hashes are set on that instead
+				if modRule.Attr("version") != nil {
+					modRule.DelAttr("hashes")
+				}
 				modRule.DelAttr("version")
-				modRule.SetAttr("download", NewStringExpr(":"+file.downloadRuleName(m, structured)))
+				setAttr(modRule, "download", NewStringExpr(":"+file.downloadRuleName(m, structured)))
 			} else {
-				if m.Licence != "" {
-					modRule.SetAttr("licences", NewStringList(m.Licence))
-				}
+				modRule.DelAttr("download")
+				updateLicences(modRule, m)
 				if m.Version != "" {
-					modRule.SetAttr("version", NewStringExpr(m.Version))
+					g.updateVersion(file, modRule, m.Version, true)
 				}
 			}
 
@@ -176,10 +293,10 @@ func (g *BuildGraph) Format(structured, write bool, thirdPartyFolder string) err
 			doneInstalls := map[string]struct{}{}
 
 			for _, i := range part.InstallWildCards {
-				installs = append(installs, i+"/...")
+				installs = append(installs, wildcardInstall(i))
 			}
 
-			for pkg := range part.Packages {
+			for _, pkg := range part.SortedPackages() {
 				if part.IsWildcardImport(pkg) {
 					continue
 				}
@@ -189,7 +306,7 @@ func (g *BuildGraph) Format(structured, write bool, thirdPartyFolder string) err
 					doneInstalls[i] = struct{}{}
 				}
 
-				for _, i := range pkg.Imports {
+				for _, i := range resolve.SortedImports(pkg) {
 					dep := g.Modules.Import(i)
 					depFile, err := g.file(dep.Module, structured, thirdPartyFolder)
 					if err != nil {
@@ -207,66 +324,92 @@ func (g *BuildGraph) Format(structured, write bool, thirdPartyFolder string) err
 
 			// The last part is the namesake and should export the rest of the parts.
 			if part.Index == len(m.Parts) {
-				modRule.SetAttr("visibility", NewStringList("PUBLIC"))
+				if modRule.Attr("visibility") == nil {
+					modRule.SetAttr("visibility", NewStringList("PUBLIC"))
+				}
 
 				for _, part := range m.Parts[:(len(m.Parts) - 1)] {
 					exportedDeps = append(exportedDeps, ":"+file.partName(part, structured))
 				}
 			} else {
-				if structured {
+				if structured && modRule.Attr("visibility") == nil {
 					modRule.SetAttr("visibility", NewStringList("PUBLIC"))
 				}
 			}
 
-			if len(installs) > 1 || (len(installs) == 1 && installs[0] != ".") {
-				modRule.SetAttr("install", NewStringList(installs...))
-			}
-
-			if len(deps) > 0 {
-				modRule.SetAttr("deps", NewStringList(deps...))
-			}
-
-			if len(exportedDeps) > 0 {
-				modRule.SetAttr("exported_deps", NewStringList(exportedDeps...))
+			// Installing the root package is the default
+			if len(installs) == 1 && installs[0] == "." && !hasManualEntries(modRule, "install") {
+				installs = nil
 			}
 
+			mergeList(modRule, "install", installs)
+			mergeList(modRule, "deps", deps)
+			mergeList(modRule, "exported_deps", exportedDeps)
 		}
 	}
 
-	tables.IsSortableListArg["install"] = true
-	for path, f := range g.Files {
-		if write {
-			if err := os.MkdirAll(filepath.Dir(f.File.Path), os.ModeDir|0775); err != nil {
-				return err
-			}
+	g.updateRenamedDeps()
+	return nil
+}
 
-			osFile, err := os.Create(f.File.Path)
-			if err != nil {
-				return err
-			}
+// Write writes the BUILD files back out, or prints them to stdout if write is false. Any files that have had all their
+// rules moved out of them are deleted. The files are written atomically: if any of them can't be written, none of them
+// are changed.
+func (g *BuildGraph) Write(write bool) error {
+	tables.IsSortableListArg["install"] = true
 
-			if _, err := osFile.Write(build.Format(f.File)); err != nil {
-				return err
-			}
-			osFile.Close()
-		} else {
-			fmt.Println("# " + path)
+	if !write {
+		for _, path := range g.removedPaths() {
+			fmt.Println("# " + path + " (deleted)")
+		}
+		for _, f := range g.sortedFiles() {
+			fmt.Println("# " + f.File.Path)
 			fmt.Println(string(build.Format(f.File)))
 		}
+		return nil
+	}
+
+	tx := journal.NewTransaction(g.Journal)
+	g.Stage(tx)
+	return tx.Commit()
+}
 
+// Stage adds the BUILD files to the transaction, so they can be written along with other files
+func (g *BuildGraph) Stage(tx *journal.Transaction) {
+	tables.IsSortableListArg["install"] = true
+
+	for _, path := range g.removedPaths() {
+		tx.Remove(path)
+	}
+	for _, f := range g.sortedFiles() {
+		tx.WriteFile(f.File.Path, build.Format(f.File), 0644)
 	}
-	return nil
+}
+
+// removedPaths returns the paths of the files that have had all their rules moved out of them, in order
+func (g *BuildGraph) removedPaths() []string {
+	ret := make([]string, 0, len(g.removedFiles))
+	for path := range g.removedFiles {
+		ret = append(ret, path)
+	}
+	sort.Strings(ret)
+	return ret
 }
 
 func NewRule(f *build.File, kind, name string) *build.Rule {
+	rule := newRule(kind, name)
+	f.Stmt = append(f.Stmt, rule.Call)
+	return rule
+}
+
+// newRule creates a rule that isn't part of a file yet
+func newRule(kind, name string) *build.Rule {
 	rule, _ := edit.ExprToRule(&build.CallExpr{
 		X:    &build.Ident{Name: kind},
 		List: []build.Expr{},
 	}, kind)
 
 	rule.SetAttr("name", NewStringExpr(name))
-
-	f.Stmt = append(f.Stmt, rule.Call)
 	return rule
 }
 
@@ -0,0 +1,387 @@
+package rules
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/buildtools/build"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/tatskaari/go-deps/resolve"
+	"github.com/tatskaari/go-deps/resolve/model"
+)
+
+var updateGolden = flag.Bool("update", false, "Update the golden files in testdata")
+
+// readGraph writes the BUILD file to a temporary third party folder and reads it into a new graph
+func readGraph(t *testing.T, contents string) (*BuildGraph, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "BUILD")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+
+	g := NewGraph("BUILD")
+	require.NoError(t, g.ReadRules(path))
+	return g, dir
+}
+
+// writeFile writes the file under root, creating any directories it's in
+func writeFile(t *testing.T, root, path, contents string) {
+	t.Helper()
+	path = filepath.Join(root, path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0775))
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+}
+
+// addPart adds a new part to the module that installs the given packages
+func addPart(g *BuildGraph, m *model.Module, pkgs ...string) *model.ModulePart {
+	part := &model.ModulePart{
+		Module:   m,
+		Packages: map[*packages.Package]struct{}{},
+		Index:    len(m.Parts) + 1,
+		Modified: true,
+	}
+	for _, p := range pkgs {
+		pkg := g.Modules.GetPackage(filepath.Join(m.Name, p))
+		pkg.Module = &packages.Module{Path: m.Name}
+		part.Packages[pkg] = struct{}{}
+		g.Modules.ImportPaths[pkg] = part
+	}
+	m.Parts = append(m.Parts, part)
+	return part
+}
+
+func ruleNames(f *build.File, kind string) []string {
+	var names []string
+	for _, rule := range f.Rules(kind) {
+		names = append(names, rule.Name())
+	}
+	return names
+}
+
+func TestPartNamesAreStable(t *testing.T) {
+	format := func() []string {
+		g, dir := readGraph(t, "")
+		m := g.Modules.GetModule(resolve.ModuleKey{Path: "example.com/foo"})
+		m.Version = "v1.0.0"
+		addPart(g, m, "a")
+		addPart(g, m, "b")
+		require.NoError(t, g.Format(false, false, dir))
+		return ruleNames(g.Files[filepath.Join(dir, "BUILD")].File, "go_module")
+	}
+
+	names := format()
+	require.Equal(t, []string{"foo_" + names[0][len("foo_"):], "foo"}, names)
+	require.Equal(t, names, format())
+}
+
+func TestNewNamesakeTakesTheModulesName(t *testing.T) {
+	g, dir := readGraph(t, `
+go_module(
+    name = "foo",
+    module = "example.com/foo",
+    version = "v1.0.0",
+    install = ["a"],
+)
+
+go_module(
+    name = "bar",
+    module = "example.com/bar",
+    version = "v1.0.0",
+    deps = [":foo"],
+)
+`)
+	m := g.Modules.GetModule(resolve.ModuleKey{Path: "example.com/foo"})
+	m.Parts[0].Modified = true
+	addPart(g, m, "b")
+
+	require.NoError(t, g.Format(false, false, dir))
+
+	f := g.Files[filepath.Join(dir, "BUILD")]
+	oldName := "foo_" + partHash(m.Parts[0])
+	require.Equal(t, oldName, f.partNames[m.Parts[0]])
+	require.Equal(t, "foo", f.partNames[m.Parts[1]], "the part that exports the rest should be named after the module")
+	require.Empty(t, g.retiredLabels())
+	require.Empty(t, ruleNames(f.File, "filegroup"))
+
+	// bar still depends on the namesake, which exports the packages it did before
+	bar := f.File.Rules("go_module")[1]
+	require.Equal(t, "bar", bar.Name())
+	require.Equal(t, []string{":foo"}, getStrListList(bar, "deps"))
+	require.Equal(t, []string{":" + oldName}, getStrListList(f.ModRules[m.Parts[1]], "exported_deps"))
+}
+
+func TestMergingTheNamesakeAwayMovesItsName(t *testing.T) {
+	g, dir := readGraph(t, `
+go_mod_download(
+    name = "foo_dl",
+    module = "example.com/foo",
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "foo_1",
+    download = ":foo_dl",
+    install = ["a"],
+    module = "example.com/foo",
+)
+
+go_module(
+    name = "foo",
+    download = ":foo_dl",
+    install = ["b"],
+    module = "example.com/foo",
+    exported_deps = [":foo_1"],
+)
+`)
+	m := g.Modules.GetModule(resolve.ModuleKey{Path: "example.com/foo"})
+	first, second := m.Parts[0], m.Parts[1]
+	for pkg := range second.Packages {
+		first.Packages[pkg] = struct{}{}
+		g.Modules.ImportPaths[pkg] = first
+	}
+	second.MergedInto = first
+	first.Modified = true
+	m.Parts = []*model.ModulePart{first}
+
+	require.NoError(t, g.Format(false, false, dir))
+
+	f := g.Files[filepath.Join(dir, "BUILD")].File
+	require.Equal(t, []string{"foo"}, ruleNames(f, "go_module"))
+	require.Equal(t, []string{"a", "b"}, getStrListList(f.Rules("go_module")[0], "install"))
+	require.Equal(t, []string{"foo_1"}, ruleNames(f, "filegroup"))
+	require.Equal(t, []string{":foo"}, getStrListList(f.Rules("filegroup")[0], "exported_deps"))
+	require.Equal(t, map[string]string{"//" + dir + ":foo_1": "//" + dir + ":foo"}, g.retiredLabels())
+}
+
+func TestMergedPartsLeaveAlias(t *testing.T) {
+	g, dir := readGraph(t, `
+go_mod_download(
+    name = "foo_dl",
+    module = "example.com/foo",
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "foo_1",
+    download = ":foo_dl",
+    install = ["a"],
+    module = "example.com/foo",
+)
+
+go_module(
+    name = "foo",
+    download = ":foo_dl",
+    install = ["b"],
+    module = "example.com/foo",
+    exported_deps = [":foo_1"],
+)
+
+go_module(
+    name = "bar",
+    module = "example.com/bar",
+    version = "v1.0.0",
+    deps = [":foo_1"],
+)
+`)
+	m := g.Modules.GetModule(resolve.ModuleKey{Path: "example.com/foo"})
+	first, second := m.Parts[0], m.Parts[1]
+	for pkg := range first.Packages {
+		second.Packages[pkg] = struct{}{}
+		g.Modules.ImportPaths[pkg] = second
+	}
+	first.MergedInto = second
+	second.Index = 1
+	second.Modified = true
+	m.Parts = []*model.ModulePart{second}
+
+	require.NoError(t, g.Format(false, false, dir))
+
+	f := g.Files[filepath.Join(dir, "BUILD")].File
+	require.Equal(t, []string{"foo", "bar"}, ruleNames(f, "go_module"))
+	require.Empty(t, ruleNames(f, "go_mod_download"))
+	require.Equal(t, []string{"foo_1"}, ruleNames(f, "filegroup"))
+	require.Equal(t, []string{":foo"}, getStrListList(f.Rules("filegroup")[0], "exported_deps"))
+	require.Equal(t, []string{":foo"}, getStrListList(f.Rules("go_module")[1], "deps"))
+}
+
+func TestMergedPartAliasesAreSorted(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		g, dir := readGraph(t, `
+go_mod_download(
+    name = "foo_dl",
+    module = "example.com/foo",
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "foo_2",
+    download = ":foo_dl",
+    install = ["b"],
+    module = "example.com/foo",
+)
+
+go_module(
+    name = "foo_1",
+    download = ":foo_dl",
+    install = ["a"],
+    module = "example.com/foo",
+)
+
+go_module(
+    name = "foo",
+    download = ":foo_dl",
+    install = ["c"],
+    module = "example.com/foo",
+    exported_deps = [":foo_1", ":foo_2"],
+)
+`)
+		m := g.Modules.GetModule(resolve.ModuleKey{Path: "example.com/foo"})
+		into := m.Parts[2]
+		for _, part := range m.Parts[:2] {
+			for pkg := range part.Packages {
+				into.Packages[pkg] = struct{}{}
+				g.Modules.ImportPaths[pkg] = into
+			}
+			part.MergedInto = into
+		}
+		into.Index = 1
+		into.Modified = true
+		m.Parts = []*model.ModulePart{into}
+
+		require.NoError(t, g.Format(false, false, dir))
+		require.Equal(t, []string{"foo_1", "foo_2"}, ruleNames(g.Files[filepath.Join(dir, "BUILD")].File, "filegroup"))
+	}
+}
+
+// copyGraph reads the BUILD file from testdata into a new graph, from a temporary copy so it can be written back
+func copyGraph(t *testing.T, name string) (*BuildGraph, string) {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	g, dir := readGraph(t, string(data))
+	return g, filepath.Join(dir, "BUILD")
+}
+
+// checkGolden checks the BUILD file matches the golden file in testdata
+func checkGolden(t *testing.T, path, golden string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	golden = filepath.Join("testdata", golden)
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(golden, data, 0644))
+	}
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(data))
+}
+
+// TestRoundTrip regenerates every rule from what it installs and depends on, and checks nothing is lost
+func TestRoundTrip(t *testing.T) {
+	g, path := copyGraph(t, "roundtrip.BUILD")
+	parts := g.PartsByLabel()
+	file := g.Files[path]
+
+	// Reading the rules doesn't tell us what the packages import, so work that out from the deps
+	for _, m := range g.Modules.SortedMods() {
+		for _, part := range m.Parts {
+			part.Modified = true
+			deps, _ := g.PartDeps(part)
+			for _, dep := range deps {
+				depPart, ok := parts[dep]
+				if !ok {
+					continue
+				}
+				from, to := part.SortedPackages()[0], depPart.SortedPackages()[0]
+				from.Imports[to.ID] = to
+			}
+		}
+	}
+	require.Len(t, file.ModRules, 3)
+
+	require.NoError(t, g.Format(false, true, filepath.Dir(path)))
+	checkGolden(t, path, "roundtrip.BUILD")
+}
+
+func TestUpdateKeepsManualChanges(t *testing.T) {
+	g, path := copyGraph(t, "update.input.BUILD")
+
+	m := g.Modules.GetModule(resolve.ModuleKey{Path: "example.com/foo"})
+	m.Version = "v1.3.0"
+	m.Licence = "MIT"
+
+	part := m.Parts[0]
+	part.Modified = true
+	part.Packages = map[*packages.Package]struct{}{}
+	for _, path := range []string{"example.com/foo/a", "example.com/foo/new"} {
+		pkg := g.Modules.GetPackage(path)
+		pkg.Module = &packages.Module{Path: m.Name}
+		part.Packages[pkg] = struct{}{}
+		g.Modules.ImportPaths[pkg] = part
+	}
+	g.Modules.Pkgs["example.com/foo/a"].Imports["example.com/bar"] = g.Modules.Pkgs["example.com/bar"]
+	g.Modules.Pkgs["example.com/foo/new"].Imports["example.com/baz"] = g.Modules.Pkgs["example.com/baz"]
+
+	require.NoError(t, g.Format(false, true, filepath.Dir(path)))
+	checkGolden(t, path, "update.golden.BUILD")
+}
+
+func TestVersionBumpRefreshesHashes(t *testing.T) {
+	g, dir := readGraph(t, `
+go_module(
+    name = "foo",
+    hashes = ["1a2b3c"],
+    module = "example.com/foo",
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "bar",
+    hashes = ["4d5e6f"],
+    module = "example.com/bar",
+    version = "v1.0.0",
+)
+`)
+	foo := g.Modules.GetModule(resolve.ModuleKey{Path: "example.com/foo"})
+	foo.Version = "v1.1.0"
+	foo.Parts[0].Modified = true
+	bar := g.Modules.GetModule(resolve.ModuleKey{Path: "example.com/bar"})
+	bar.Parts[0].Modified = true
+
+	require.NoError(t, g.Update(false, dir))
+
+	label := "//" + dir + ":foo"
+	require.Equal(t, []string{label}, g.HashTargets())
+	require.Equal(t, map[string][]string{"//" + dir + ":bar": {"4d5e6f"}}, g.Hashes())
+
+	g.SetHashes(map[string]string{label: "7a8b9c"})
+	require.Empty(t, g.HashTargets())
+	require.Equal(t, []string{"7a8b9c"}, g.Hashes()[label])
+}
+
+func TestMigrateToGoRepo(t *testing.T) {
+	g, path := copyGraph(t, "migrate.input.BUILD")
+
+	g.MigrateToGoRepo()
+	require.NoError(t, g.Format(false, true, filepath.Dir(path)))
+	checkGolden(t, path, "migrate.golden.BUILD")
+
+	// Reading the go_repo() rules back in should give the same rules
+	g, path = copyGraph(t, "migrate.golden.BUILD")
+	require.True(t, g.GoRepo)
+	for _, m := range g.Modules.Mods {
+		for _, part := range m.Parts {
+			part.Modified = true
+		}
+	}
+	require.NoError(t, g.Format(false, true, filepath.Dir(path)))
+	checkGolden(t, path, "migrate.golden.BUILD")
+}
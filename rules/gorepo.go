@@ -0,0 +1,139 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/buildtools/build"
+
+	"github.com/tatskaari/go-deps/resolve/model"
+)
+
+// subrepoName returns the name of the subrepo go_repo() creates for the module
+func subrepoName(m *model.Module) string {
+	return strings.ReplaceAll(m.Name, "/", "_")
+}
+
+// goRepoName returns the name of the go_repo() rule for the module. New rules are named after the module's subrepo, so
+// the rule and its subrepo have the same name.
+func (file *BuildFile) goRepoName(m *model.Module) string {
+	for _, part := range m.Parts {
+		if rule, ok := file.ModRules[part]; ok && rule.Kind() == "go_repo" {
+			return rule.Name()
+		}
+	}
+
+	name := subrepoName(m)
+	for i := 1; ; i++ {
+		if extant, ok := file.usedNames[name]; !ok || extant == m.Name {
+			break
+		}
+		name = fmt.Sprintf("%s_%d", subrepoName(m), i)
+	}
+	file.usedNames[name] = m.Name
+	return name
+}
+
+// updateGoRepo updates the go_repo() rule for the module. Unlike go_module(), there's one rule for the whole module,
+// which installs the packages of all its parts. Any go_module() rules for the module are converted: the namesake becomes
+// the go_repo() rule, and the rest are replaced with aliases to it.
+func (g *BuildGraph) updateGoRepo(file *BuildFile, m *model.Module, dlRule *build.Rule, structured bool) {
+	name := file.goRepoName(m)
+
+	var rule *build.Rule
+	for _, part := range m.Parts {
+		if r, ok := file.ModRules[part]; ok && r.Kind() == "go_repo" {
+			rule = r
+		}
+	}
+
+	if rule == nil {
+		for i := len(m.Parts) - 1; i >= 0; i-- {
+			modRule, ok := file.ModRules[m.Parts[i]]
+			if !ok {
+				continue
+			}
+			oldName := modRule.Name()
+			if rule == nil {
+				rule = modRule
+				rule.SetKind("go_repo")
+				setAttr(rule, "name", NewStringExpr(name))
+				// These are for the outputs of the go_module(), so aren't right for the go_repo()
+				rule.DelAttr("hashes")
+			} else {
+				file.File.DelRules("go_module", oldName)
+			}
+			if oldName != name {
+				g.renames[absoluteLabel(file.pkg(), ":"+oldName)] = absoluteLabel(file.pkg(), ":"+name)
+				newAlias(file.File, oldName, ":"+name)
+			}
+		}
+	}
+	if rule == nil {
+		rule = NewRule(file.File, "go_repo", name)
+	}
+	for _, part := range m.Parts {
+		file.ModRules[part] = rule
+	}
+
+	setAttr(rule, "module", NewStringExpr(m.Name))
+
+	// Modules only need a go_mod_download() if they're replaced
+	if dlRule != nil && m.ReplacedBy == "" {
+		if rule.Attr("licences") == nil && dlRule.Attr("licences") != nil {
+			rule.SetAttr("licences", dlRule.Attr("licences"))
+		}
+		file.File.DelRules("go_mod_download", dlRule.Name())
+		delete(file.ModDownloadRules, m)
+		dlRule = nil
+	}
+
+	if dlRule != nil {
+		rule.DelAttr("version")
+		setAttr(rule, "download", NewStringExpr(":"+file.downloadRuleName(m, structured)))
+	} else {
+		rule.DelAttr("download")
+		if m.Version != "" {
+			g.updateVersion(file, rule, m.Version, false)
+		}
+	}
+	updateLicences(rule, m)
+	if rule.Attr("visibility") == nil {
+		rule.SetAttr("visibility", NewStringList("PUBLIC"))
+	}
+
+	installs := map[string]struct{}{}
+	for _, part := range m.Parts {
+		for _, i := range part.InstallWildCards {
+			installs[wildcardInstall(i)] = struct{}{}
+		}
+		for pkg := range part.Packages {
+			if !part.IsWildcardImport(pkg) {
+				installs[toInstall(pkg)] = struct{}{}
+			}
+		}
+	}
+	install := make([]string, 0, len(installs))
+	for i := range installs {
+		install = append(install, i)
+	}
+	sort.Strings(install)
+	mergeList(rule, "install", install)
+
+	// go_repo() works out its deps from the subrepos of the other modules
+	mergeList(rule, "deps", nil)
+	mergeList(rule, "exported_deps", nil)
+}
+
+// MigrateToGoRepo converts the go_module() rules in the graph into go_repo() rules when the graph is next updated. Each
+// module gets one go_repo(), named after its subrepo, that installs everything its parts did. The old rules are replaced
+// with aliases to it.
+func (g *BuildGraph) MigrateToGoRepo() {
+	g.GoRepo = true
+	for _, m := range g.Modules.Mods {
+		for _, part := range m.Parts {
+			part.Modified = true
+		}
+	}
+}
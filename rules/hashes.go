@@ -0,0 +1,88 @@
+package rules
+
+import (
+	"sort"
+
+	"github.com/bazelbuild/buildtools/build"
+
+	"github.com/tatskaari/go-deps/resolve/model"
+)
+
+// updateVersion sets the version of a rule that downloads a module. If the version has changed, the hashes are removed
+// as they're for the old version. If the module has been modified, and the rule has no hashes, they're marked as
+// needing to be computed.
+func (g *BuildGraph) updateVersion(file *BuildFile, rule *build.Rule, version string, modified bool) {
+	if rule.AttrString("version") != version {
+		rule.DelAttr("hashes")
+	}
+	setAttr(rule, "version", NewStringExpr(version))
+
+	if modified && rule.Attr("hashes") == nil {
+		g.needsHash[absoluteLabel(file.pkg(), ":"+rule.Name())] = struct{}{}
+	}
+}
+
+// HashTargets returns the labels of the rules that need their hashes computing, in order
+func (g *BuildGraph) HashTargets() []string {
+	ret := make([]string, 0, len(g.needsHash))
+	for label := range g.needsHash {
+		ret = append(ret, label)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// SetHashes sets the hashes of the rules, keyed by their label
+func (g *BuildGraph) SetHashes(hashes map[string]string) {
+	for label, rule := range g.downloadRules() {
+		if hash, ok := hashes[label]; ok {
+			setAttr(rule, "hashes", NewStringList(hash))
+			delete(g.needsHash, label)
+		}
+	}
+}
+
+// Hashes returns the hashes of the rules that download modules, keyed by their label. Rules without hashes are skipped.
+func (g *BuildGraph) Hashes() map[string][]string {
+	ret := map[string][]string{}
+	for label, rule := range g.downloadRules() {
+		if hashes, ok := literalStrings(rule.Attr("hashes")); ok && len(hashes) > 0 {
+			ret[label] = hashes
+		}
+	}
+	return ret
+}
+
+// ModuleHashes returns the hashes on the rule that downloads the module i.e. its go_mod_download() rule, or the namesake
+// if it doesn't have one
+func (g *BuildGraph) ModuleHashes(m *model.Module) []string {
+	file, ok := g.ModFiles[m]
+	if !ok || len(m.Parts) == 0 {
+		return nil
+	}
+	rule, ok := file.ModDownloadRules[m]
+	if !ok {
+		if rule, ok = file.ModRules[m.Parts[len(m.Parts)-1]]; !ok {
+			return nil
+		}
+	}
+	hashes, _ := literalStrings(rule.Attr("hashes"))
+	return hashes
+}
+
+// downloadRules returns the rules that download modules keyed by their label i.e. the go_mod_download() rules, and the
+// go_module() rules that don't have one
+func (g *BuildGraph) downloadRules() map[string]*build.Rule {
+	ret := map[string]*build.Rule{}
+	for _, file := range g.Files {
+		for _, rule := range file.ModDownloadRules {
+			ret[absoluteLabel(file.pkg(), ":"+rule.Name())] = rule
+		}
+		for _, rule := range file.ModRules {
+			if rule.Attr("download") == nil {
+				ret[absoluteLabel(file.pkg(), ":"+rule.Name())] = rule
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,70 @@
+package rules
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/tatskaari/go-deps/resolve/model"
+)
+
+// pkg returns the Please package the BUILD file defines
+func (file *BuildFile) pkg() string {
+	return filepath.Dir(filepath.Clean(file.File.Path))
+}
+
+// absoluteLabel resolves a label found in the given package to its fully qualified form e.g. :foo -> //pkg:foo and
+// //pkg/foo -> //pkg/foo:foo
+func absoluteLabel(pkg, label string) string {
+	if strings.HasPrefix(label, ":") {
+		return "//" + pkg + label
+	}
+	if strings.HasPrefix(label, "//") && !strings.Contains(label, ":") {
+		return label + ":" + filepath.Base(label)
+	}
+	return label
+}
+
+// PartLabel returns the fully qualified label of the go_module() rule for a module part, or an empty string if the
+// part doesn't have a rule yet.
+func (g *BuildGraph) PartLabel(part *model.ModulePart) string {
+	file, ok := g.ModFiles[part.Module]
+	if !ok {
+		return ""
+	}
+	rule, ok := file.ModRules[part]
+	if !ok {
+		return ""
+	}
+	return "//" + file.pkg() + ":" + rule.Name()
+}
+
+// PartsByLabel returns all the module parts in the graph keyed by the fully qualified label of their go_module() rule
+func (g *BuildGraph) PartsByLabel() map[string]*model.ModulePart {
+	ret := map[string]*model.ModulePart{}
+	for _, file := range g.Files {
+		for part, rule := range file.ModRules {
+			ret["//"+file.pkg()+":"+rule.Name()] = part
+		}
+	}
+	return ret
+}
+
+// PartDeps returns the fully qualified labels of the deps of the go_module() rule for this part. The exported deps are
+// returned separately.
+func (g *BuildGraph) PartDeps(part *model.ModulePart) (deps, exportedDeps []string) {
+	file, ok := g.ModFiles[part.Module]
+	if !ok {
+		return nil, nil
+	}
+	rule, ok := file.ModRules[part]
+	if !ok {
+		return nil, nil
+	}
+	for _, dep := range getStrListList(rule, "deps") {
+		deps = append(deps, absoluteLabel(file.pkg(), dep))
+	}
+	for _, dep := range getStrListList(rule, "exported_deps") {
+		exportedDeps = append(exportedDeps, absoluteLabel(file.pkg(), dep))
+	}
+	return deps, exportedDeps
+}
@@ -0,0 +1,188 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/bazelbuild/buildtools/build"
+
+	"github.com/tatskaari/go-deps/resolve/model"
+)
+
+// movedRule is a rule that's being moved to another file as part of a layout migration
+type movedRule struct {
+	rule     *build.Rule
+	from, to *BuildFile
+	name     string
+}
+
+// MigrateLayout moves the third party rules into the files they belong in for the flat or structured layout. The rules
+// are moved as they are, so their comments and any attributes we don't set are kept. Aliases left by go-deps move with
+// the rule they alias. Rules are only renamed if their name is already taken in the file they're moved to. Labels in
+// the rules are updated to their new location, and files that have nothing left in them are removed when the graph is
+// written.
+func (g *BuildGraph) MigrateLayout(structured bool, thirdPartyFolder string) error {
+	var moves []*movedRule
+	movedLabels := map[string]*BuildFile{}
+
+	for _, m := range g.Modules.SortedMods() {
+		from, ok := g.ModFiles[m]
+		if !ok {
+			continue
+		}
+		to, err := g.file(m, structured, thirdPartyFolder)
+		if err != nil {
+			return err
+		}
+		if from == to {
+			continue
+		}
+
+		names := map[string]string{}
+		for _, rule := range from.moduleRules(m) {
+			move := &movedRule{rule: rule, from: from, to: to, name: to.moveName(m.Name, rule.Name())}
+			moves = append(moves, move)
+			names[rule.Name()] = move.name
+			movedLabels[absoluteLabel(from.pkg(), ":"+rule.Name())] = to
+			g.renames[absoluteLabel(from.pkg(), ":"+rule.Name())] = absoluteLabel(to.pkg(), ":"+move.name)
+		}
+		to.moveModule(from, m, names)
+	}
+
+	// Aliases to the rules we're moving go with them, so the old name can still be found next to the rule
+	for _, file := range g.sortedFiles() {
+		for _, rule := range file.File.Rules("filegroup") {
+			actual, ok := literalStrings(rule.Attr("exported_deps"))
+			if !ok || len(actual) != 1 {
+				continue
+			}
+			to, ok := movedLabels[absoluteLabel(file.pkg(), actual[0])]
+			if !ok {
+				continue
+			}
+			move := &movedRule{rule: rule, from: file, to: to, name: to.moveName("", rule.Name())}
+			moves = append(moves, move)
+			g.renames[absoluteLabel(file.pkg(), ":"+rule.Name())] = absoluteLabel(to.pkg(), ":"+move.name)
+		}
+	}
+
+	moved := map[*build.CallExpr]struct{}{}
+	sources := map[*BuildFile]struct{}{}
+	for _, move := range moves {
+		relabel(move.rule, move.from.pkg(), move.to.pkg(), g.renames)
+		move.from.File.DelRules("", move.rule.Name())
+		if move.rule.Name() != move.name {
+			setAttr(move.rule, "name", NewStringExpr(move.name))
+		}
+		// Parts are depended on by modules in other packages in the structured layout
+		if structured && move.rule.Kind() != "go_mod_download" && move.rule.Attr("visibility") == nil {
+			move.rule.SetAttr("visibility", NewStringList("PUBLIC"))
+		}
+		move.to.File.Stmt = append(move.to.File.Stmt, move.rule.Call)
+		moved[move.rule.Call] = struct{}{}
+		sources[move.from] = struct{}{}
+	}
+
+	for _, file := range g.sortedFiles() {
+		for _, rule := range file.File.Rules("") {
+			if _, ok := moved[rule.Call]; !ok {
+				relabel(rule, file.pkg(), file.pkg(), g.renames)
+			}
+		}
+	}
+
+	for path, file := range g.Files {
+		if _, ok := sources[file]; ok && isEmpty(file.File) {
+			delete(g.Files, path)
+			g.removedFiles[path] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// moduleRules returns the rules for the module in the file i.e. the rules for its parts, and its go_mod_download()
+// rule, in the order they're in the file
+func (file *BuildFile) moduleRules(m *model.Module) []*build.Rule {
+	calls := map[*build.CallExpr]struct{}{}
+	for _, part := range m.Parts {
+		if rule, ok := file.ModRules[part]; ok {
+			calls[rule.Call] = struct{}{}
+		}
+	}
+	if rule, ok := file.ModDownloadRules[m]; ok {
+		calls[rule.Call] = struct{}{}
+	}
+
+	var ret []*build.Rule
+	for _, rule := range file.File.Rules("") {
+		if _, ok := calls[rule.Call]; ok {
+			ret = append(ret, rule)
+		}
+	}
+	return ret
+}
+
+// moveModule moves the bookkeeping for the module's rules from the other file to this one. The names map the old names
+// of the rules to their names in this file.
+func (file *BuildFile) moveModule(from *BuildFile, m *model.Module, names map[string]string) {
+	newName := func(old string) string {
+		if name, ok := names[old]; ok {
+			return name
+		}
+		return old
+	}
+
+	for _, part := range m.Parts {
+		if rule, ok := from.ModRules[part]; ok {
+			file.ModRules[part] = rule
+			delete(from.ModRules, part)
+		}
+		if name, ok := from.partNames[part]; ok {
+			file.partNames[part] = newName(name)
+			delete(from.partNames, part)
+		}
+	}
+	if rule, ok := from.ModDownloadRules[m]; ok {
+		file.ModDownloadRules[m] = rule
+		delete(from.ModDownloadRules, m)
+	}
+	if name, ok := from.downloadNames[m]; ok {
+		file.downloadNames[m] = newName(name)
+		delete(from.downloadNames, m)
+	}
+	if name, ok := from.moduleNames[m]; ok {
+		file.moduleNames[m] = newName(name)
+		delete(from.moduleNames, m)
+	}
+}
+
+// moveName returns the name a rule for the module should have once it's moved to this file. The rule keeps its name if
+// it's free. Otherwise, it's prefixed with the module's path, as assignName does, until it's unique.
+func (file *BuildFile) moveName(modPath, name string) string {
+	path, _ := split(modPath)
+	orig := name
+	for i := 1; ; i++ {
+		extant, ok := file.usedNames[name]
+		if !ok || (modPath != "" && extant == modPath) {
+			break
+		}
+		var base string
+		path, base = split(path)
+		if base == "" || base == "." {
+			name = fmt.Sprintf("%s_%d", orig, i)
+			continue
+		}
+		name = base + "." + name
+	}
+	file.usedNames[name] = modPath
+	return name
+}
+
+// isEmpty returns true if the file has nothing left in it apart from comments
+func isEmpty(f *build.File) bool {
+	for _, stmt := range f.Stmt {
+		if _, ok := stmt.(*build.CommentBlock); !ok {
+			return false
+		}
+	}
+	return true
+}
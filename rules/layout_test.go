@@ -0,0 +1,179 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const flatLayout = `# Pinned until we can upgrade
+go_module(
+    name = "foo",
+    module = "example.com/foo",
+    strip = ["vendor"],
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "bar_1a2b3c4",
+    download = ":bar_dl",
+    install = ["a"],
+    module = "example.com/bar",
+    deps = [":foo"],
+)
+
+go_mod_download(
+    name = "bar_dl",
+    module = "example.com/bar",
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "bar",
+    download = ":bar_dl",
+    exported_deps = [":bar_1a2b3c4"],
+    install = ["b"],
+    module = "example.com/bar",
+    visibility = ["PUBLIC"],
+    deps = [":foo"],
+)
+
+filegroup(
+    name = "bar_2",
+    exported_deps = [":bar"],
+    visibility = ["PUBLIC"],
+)
+`
+
+func TestMigrateLayout(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "third_party/go"), 0775))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "third_party/go/BUILD"), []byte(flatLayout), 0644))
+
+	// Labels are relative to the repo root, which is the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	readAll := func() *BuildGraph {
+		g := NewGraph("BUILD")
+		err := filepath.Walk("third_party/go", func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			return g.ReadRules(path)
+		})
+		require.NoError(t, err)
+		return g
+	}
+
+	g := readAll()
+	require.NoError(t, g.MigrateLayout(true, "third_party/go"))
+	require.NoError(t, g.Write(true))
+
+	_, err = os.Stat("third_party/go/BUILD")
+	require.True(t, os.IsNotExist(err), "the flat BUILD file should have been removed")
+	require.Equal(t, "//third_party/go/example.com/bar:bar", g.renames["//third_party/go:bar"])
+	require.Equal(t, "//third_party/go/example.com/bar:bar_2", g.renames["//third_party/go:bar_2"])
+
+	data, err := os.ReadFile("third_party/go/example.com/foo/BUILD")
+	require.NoError(t, err)
+	require.Equal(t, `# Pinned until we can upgrade
+go_module(
+    name = "foo",
+    module = "example.com/foo",
+    strip = ["vendor"],
+    version = "v1.0.0",
+    visibility = ["PUBLIC"],
+)
+`, string(data))
+
+	data, err = os.ReadFile("third_party/go/example.com/bar/BUILD")
+	require.NoError(t, err)
+	require.Equal(t, `go_module(
+    name = "bar_1a2b3c4",
+    download = ":bar_dl",
+    install = ["a"],
+    module = "example.com/bar",
+    visibility = ["PUBLIC"],
+    deps = ["//third_party/go/example.com/foo"],
+)
+
+go_mod_download(
+    name = "bar_dl",
+    module = "example.com/bar",
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "bar",
+    download = ":bar_dl",
+    exported_deps = [":bar_1a2b3c4"],
+    install = ["b"],
+    module = "example.com/bar",
+    visibility = ["PUBLIC"],
+    deps = ["//third_party/go/example.com/foo"],
+)
+
+filegroup(
+    name = "bar_2",
+    exported_deps = [":bar"],
+    visibility = ["PUBLIC"],
+)
+`, string(data))
+
+	// Migrating back moves the rules into one file, keeping the visibility the structured layout needed
+	g = readAll()
+	require.NoError(t, g.MigrateLayout(false, "third_party/go"))
+	require.NoError(t, g.Write(true))
+
+	for _, path := range []string{"third_party/go/example.com/foo/BUILD", "third_party/go/example.com/bar/BUILD"} {
+		_, err = os.Stat(path)
+		require.True(t, os.IsNotExist(err), "%s should have been removed", path)
+	}
+	data, err = os.ReadFile("third_party/go/BUILD")
+	require.NoError(t, err)
+	require.Equal(t, `go_module(
+    name = "bar_1a2b3c4",
+    download = ":bar_dl",
+    install = ["a"],
+    module = "example.com/bar",
+    visibility = ["PUBLIC"],
+    deps = [":foo"],
+)
+
+go_mod_download(
+    name = "bar_dl",
+    module = "example.com/bar",
+    version = "v1.0.0",
+)
+
+go_module(
+    name = "bar",
+    download = ":bar_dl",
+    exported_deps = [":bar_1a2b3c4"],
+    install = ["b"],
+    module = "example.com/bar",
+    visibility = ["PUBLIC"],
+    deps = [":foo"],
+)
+
+# Pinned until we can upgrade
+go_module(
+    name = "foo",
+    module = "example.com/foo",
+    strip = ["vendor"],
+    version = "v1.0.0",
+    visibility = ["PUBLIC"],
+)
+
+filegroup(
+    name = "bar_2",
+    exported_deps = [":bar"],
+    visibility = ["PUBLIC"],
+)
+`, string(data))
+}
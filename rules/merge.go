@@ -0,0 +1,159 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/buildtools/build"
+
+	"github.com/tatskaari/go-deps/resolve/model"
+)
+
+// relativeLabel returns the shortest form of a fully qualified label when referenced from the given package
+func relativeLabel(pkg, label string) string {
+	if strings.HasPrefix(label, "//"+pkg+":") {
+		return strings.TrimPrefix(label, "//"+pkg)
+	}
+	return label
+}
+
+// sortedFiles returns the BUILD files in the graph sorted by their path
+func (g *BuildGraph) sortedFiles() []*BuildFile {
+	paths := make([]string, 0, len(g.Files))
+	for path := range g.Files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	ret := make([]*BuildFile, 0, len(paths))
+	for _, path := range paths {
+		ret = append(ret, g.Files[path])
+	}
+	return ret
+}
+
+// sortedParts returns the parts that have rules in the file, sorted by the name of their rule
+func (file *BuildFile) sortedParts() []*model.ModulePart {
+	ret := make([]*model.ModulePart, 0, len(file.ModRules))
+	for part := range file.ModRules {
+		ret = append(ret, part)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return file.ModRules[ret[i]].Name() < file.ModRules[ret[j]].Name()
+	})
+	return ret
+}
+
+// removeMergedParts replaces the rules for the parts that have been merged into other parts of their module with an
+// alias to the part they were merged into, so the name is never reused. If the module is no longer split, and isn't
+// replaced, its go_mod_download() rule is no longer needed so that is removed.
+func (g *BuildGraph) removeMergedParts(structured bool) {
+	for _, file := range g.sortedFiles() {
+		merged := map[*model.Module]struct{}{}
+		for _, part := range file.sortedParts() {
+			rule := file.ModRules[part]
+			if part.MergedInto == nil {
+				continue
+			}
+			// All the parts of a module share the go_repo() rule, so there's nothing to remove
+			if rule.Kind() == "go_repo" {
+				delete(file.ModRules, part)
+				continue
+			}
+			into := part.MergedInto
+			for into.MergedInto != nil {
+				into = into.MergedInto
+			}
+
+			intoName := file.partName(into, structured)
+			delete(file.ModRules, part)
+			merged[part.Module] = struct{}{}
+			// The part it was merged into is the namesake now, and takes its name
+			if rule.Name() == intoName {
+				file.File.DelRules("go_module", rule.Name())
+				continue
+			}
+			g.renames[absoluteLabel(file.pkg(), ":"+rule.Name())] = absoluteLabel(file.pkg(), ":"+intoName)
+			file.File.DelRules("go_module", rule.Name())
+			alias := newAlias(file.File, rule.Name(), ":"+intoName)
+			alias.Call.Comments.Before = append(rule.Call.Comments.Before, alias.Call.Comments.Before...)
+		}
+
+		for m := range merged {
+			dlRule, ok := file.ModDownloadRules[m]
+			if !ok || len(m.Parts) > 1 || m.ReplacedBy != "" {
+				continue
+			}
+			file.File.DelRules("go_mod_download", dlRule.Name())
+			delete(file.ModDownloadRules, m)
+		}
+	}
+}
+
+// newAlias adds a rule that aliases another rule. Rules that are renamed, merged away or converted to another kind are
+// replaced with one of these, so existing references to them, including those outside the repo we can't update, keep
+// working.
+func newAlias(f *build.File, name, actual string) *build.Rule {
+	rule := NewRule(f, "filegroup", name)
+	rule.SetAttr("exported_deps", NewStringList(actual))
+	rule.SetAttr("visibility", NewStringList("PUBLIC"))
+	rule.Call.Comments.Before = []build.Comment{{
+		Token: fmt.Sprintf("# %s has been renamed to %s. This alias was left by go-deps so existing references keep working.", name, actual),
+	}}
+	return rule
+}
+
+// updateRenamedDeps updates any deps on the rules that have been renamed. The deps of the rules we've just generated are
+// already up to date.
+func (g *BuildGraph) updateRenamedDeps() {
+	if len(g.renames) == 0 {
+		return
+	}
+	for _, file := range g.sortedFiles() {
+		generated := map[*build.CallExpr]struct{}{}
+		for part, rule := range file.ModRules {
+			if part.Modified {
+				generated[rule.Call] = struct{}{}
+			}
+		}
+
+		for _, rule := range file.File.Rules("") {
+			if _, ok := generated[rule.Call]; ok {
+				continue
+			}
+			for _, attr := range []string{"deps", "exported_deps"} {
+				list, ok := rule.Attr(attr).(*build.ListExpr)
+				if !ok {
+					continue
+				}
+
+				done := map[string]struct{}{}
+				newList := make([]build.Expr, 0, len(list.List))
+				for _, expr := range list.List {
+					str, ok := expr.(*build.StringExpr)
+					if !ok {
+						newList = append(newList, expr)
+						continue
+					}
+					if newLabel, ok := g.renames[absoluteLabel(file.pkg(), str.Value)]; ok {
+						str.Value = relativeLabel(file.pkg(), newLabel)
+					}
+					if _, ok := done[str.Value]; ok {
+						continue
+					}
+					// Don't depend on ourselves
+					if absoluteLabel(file.pkg(), str.Value) == absoluteLabel(file.pkg(), ":"+rule.Name()) {
+						continue
+					}
+					done[str.Value] = struct{}{}
+					newList = append(newList, str)
+				}
+				list.List = newList
+				if len(list.List) == 0 {
+					rule.DelAttr(attr)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package rules
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/buildtools/build"
+
+	"github.com/tatskaari/go-deps/resolve"
+)
+
+// Problem is something structurally wrong with the third party rules, which Please would only report when it builds
+// them
+type Problem struct {
+	// Path and Line are where the problem is in the BUILD file
+	Path    string
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.Path, p.Line, p.Message)
+}
+
+// moduleRule is a go_module() or go_repo() rule, and the file it's in
+type moduleRule struct {
+	file *BuildFile
+	rule *build.Rule
+}
+
+func (r moduleRule) label() string {
+	return "//" + r.file.pkg() + ":" + r.rule.Name()
+}
+
+// problem returns a problem at the position of the rule, or of the value in one of its list attributes if it's given
+func (r moduleRule) problem(attr, value, format string, args ...interface{}) Problem {
+	return Problem{
+		Path:    r.file.File.Path,
+		Line:    attrLine(r.rule, attr, value),
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// Problems checks the rules as they were read for deps on rules that don't exist in the third party folder, download
+// labels that aren't go_mod_download() rules, cycles between the go_module() rules, and modules that are defined more
+// than once. These should be checked before the duplicates are merged. Problems are returned in the order of the files
+// they're in.
+func (g *BuildGraph) Problems(thirdPartyFolder string) []Problem {
+	var rules []moduleRule
+	// The kind of each rule, keyed by package and then name
+	kinds := map[string]map[string]string{}
+	for _, file := range g.sortedFiles() {
+		kinds[file.pkg()] = map[string]string{}
+		for _, rule := range file.File.Rules("") {
+			kinds[file.pkg()][rule.Name()] = rule.Kind()
+			if rule.Kind() == "go_module" || rule.Kind() == "go_repo" {
+				rules = append(rules, moduleRule{file: file, rule: rule})
+			}
+		}
+	}
+
+	ret := g.duplicateProblems()
+	ret = append(ret, missingDepProblems(rules, kinds, thirdPartyFolder)...)
+	ret = append(ret, downloadProblems(rules, kinds)...)
+	ret = append(ret, cycleProblems(rules)...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Path != ret[j].Path {
+			return ret[i].Path < ret[j].Path
+		}
+		return ret[i].Line < ret[j].Line
+	})
+	return ret
+}
+
+// duplicateProblems finds the modules that are defined in more than one file
+func (g *BuildGraph) duplicateProblems() []Problem {
+	var ret []Problem
+	for _, m := range g.Modules.SortedMods() {
+		files := g.moduleFiles(m)
+		if len(files) < 2 {
+			continue
+		}
+		paths := make([]string, 0, len(files))
+		for _, file := range files {
+			paths = append(paths, file.File.Path)
+		}
+		for _, file := range files {
+			line := 0
+			for _, part := range file.moduleParts(m) {
+				line = ruleLine(file.ModRules[part])
+				break
+			}
+			if rule, ok := file.ModDownloadRules[m]; ok && line == 0 {
+				line = ruleLine(rule)
+			}
+			ret = append(ret, Problem{
+				Path:    file.File.Path,
+				Line:    line,
+				Message: fmt.Sprintf("%s is defined in more than one place: %s. Run go-deps to merge them into one.", m.Name, strings.Join(paths, ", ")),
+			})
+		}
+	}
+	return ret
+}
+
+// missingDepProblems finds deps and exported deps on rules in the third party folder that don't exist. We can't tell
+// whether labels outside the third party folder exist, so they're skipped.
+func missingDepProblems(rules []moduleRule, kinds map[string]map[string]string, thirdPartyFolder string) []Problem {
+	thirdPartyFolder = filepath.Clean(thirdPartyFolder)
+
+	var ret []Problem
+	for _, r := range rules {
+		for _, attr := range []string{"deps", "exported_deps"} {
+			for _, dep := range getStrListList(r.rule, attr) {
+				label := absoluteLabel(r.file.pkg(), dep)
+				pkg, name := splitLabel(label)
+				if pkg != thirdPartyFolder && !strings.HasPrefix(pkg, thirdPartyFolder+"/") {
+					continue
+				}
+				if _, ok := kinds[pkg][name]; ok {
+					continue
+				}
+				ret = append(ret, r.problem(attr, dep, "%s of %s is %s, which doesn't exist. Remove it, or point it at the rule that replaced it.", attr, r.rule.Name(), label))
+			}
+		}
+	}
+	return ret
+}
+
+// downloadProblems finds the rules whose download label isn't a go_mod_download() rule. Like deps, we can only check
+// labels in the files we've read.
+func downloadProblems(rules []moduleRule, kinds map[string]map[string]string) []Problem {
+	var ret []Problem
+	for _, r := range rules {
+		download := r.rule.AttrString("download")
+		if download == "" {
+			continue
+		}
+		label := absoluteLabel(r.file.pkg(), download)
+		pkg, name := splitLabel(label)
+		pkgKinds, ok := kinds[pkg]
+		if !ok {
+			continue
+		}
+		switch kind, ok := pkgKinds[name]; {
+		case !ok:
+			ret = append(ret, r.problem("download", "", "download of %s is %s, which doesn't exist. Add a go_mod_download() rule for %s, or set the version on %s instead.", r.rule.Name(), label, r.rule.AttrString("module"), r.rule.Name()))
+		case kind != "go_mod_download":
+			ret = append(ret, r.problem("download", "", "download of %s is %s, which is a %s() rather than a go_mod_download()", r.rule.Name(), label, kind))
+		}
+	}
+	return ret
+}
+
+// cycleProblems finds the cycles between the go_module() rules through their deps and exported deps. Each cycle is
+// reported once, at the first rule in it.
+func cycleProblems(rules []moduleRule) []Problem {
+	byLabel := make(map[string]moduleRule, len(rules))
+	nodes := make([]interface{}, 0, len(rules))
+	for _, r := range rules {
+		byLabel[r.label()] = r
+		nodes = append(nodes, r.label())
+	}
+
+	deps := func(node interface{}) []interface{} {
+		r := byLabel[node.(string)]
+		var ret []interface{}
+		for _, attr := range []string{"deps", "exported_deps"} {
+			for _, dep := range getStrListList(r.rule, attr) {
+				if label := absoluteLabel(r.file.pkg(), dep); label != r.label() {
+					if _, ok := byLabel[label]; ok {
+						ret = append(ret, label)
+					}
+				}
+			}
+		}
+		return ret
+	}
+
+	var ret []Problem
+	resolve.WalkCycles(nodes, deps, func(cycle []interface{}) bool {
+		labels := make([]string, 0, len(cycle))
+		for _, node := range cycle {
+			labels = append(labels, node.(string))
+		}
+		first := byLabel[labels[0]]
+		ret = append(ret, first.problem("", "", "go_module() rules depend on each other in a cycle: %s. Run go-deps on these modules to split them into parts that don't.", strings.Join(labels, " -> ")))
+		return true
+	})
+	return ret
+}
+
+// splitLabel splits a fully qualified label into its package and name
+func splitLabel(label string) (string, string) {
+	label = strings.TrimPrefix(label, "//")
+	if i := strings.LastIndex(label, ":"); i >= 0 {
+		return label[:i], label[i+1:]
+	}
+	return label, filepath.Base(label)
+}
+
+// attrLine returns the line of the value in the rule's list attribute, the line of the attribute if the value is
+// empty, or the line of the rule if it's not there
+func attrLine(rule *build.Rule, attr, value string) int {
+	if value == "" && attr != "" {
+		if a := rule.AttrDefn(attr); a != nil {
+			start, _ := a.Span()
+			return start.Line
+		}
+	}
+	if list, ok := rule.Attr(attr).(*build.ListExpr); ok {
+		for _, i := range list.List {
+			if s, ok := i.(*build.StringExpr); ok && s.Value == value {
+				start, _ := s.Span()
+				return start.Line
+			}
+		}
+	}
+	return ruleLine(rule)
+}
+
+// ruleLine returns the line the rule starts on
+func ruleLine(rule *build.Rule) int {
+	start, _ := rule.Call.Span()
+	return start.Line
+}
@@ -0,0 +1,87 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProblems(t *testing.T) {
+	// Labels are relative to the repo root, which is the working directory
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	dir := "third_party/go"
+	files := map[string]string{
+		"BUILD": `go_module(
+    name = "foo",
+    module = "example.com/foo",
+    version = "v1.0.0",
+    deps = [
+        ":bar",
+        ":missing",
+        "//some/first/party:lib",
+    ],
+)
+
+go_module(
+    name = "bar",
+    module = "example.com/bar",
+    version = "v1.0.0",
+    exported_deps = [":foo"],
+)
+
+go_module(
+    name = "qux",
+    download = ":qux_dl",
+    module = "example.com/qux",
+)
+
+go_module(
+    name = "quux",
+    download = ":bar",
+    module = "example.com/quux",
+)
+`,
+		"example.com/baz/BUILD": `go_module(
+    name = "baz",
+    module = "example.com/baz",
+    version = "v1.0.0",
+    deps = ["//` + dir + `/example.com/nope"],
+)
+`,
+		"example.com/foo/BUILD": `go_module(
+    name = "foo",
+    module = "example.com/foo",
+    version = "v1.1.0",
+)
+`,
+	}
+
+	g := NewGraph("BUILD")
+	for _, name := range []string{"BUILD", "example.com/baz/BUILD", "example.com/foo/BUILD"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0775))
+		require.NoError(t, os.WriteFile(path, []byte(files[name]), 0644))
+		require.NoError(t, g.ReadRules(path))
+	}
+
+	var problems []string
+	for _, p := range g.Problems(dir) {
+		problems = append(problems, p.String())
+	}
+	flat, baz, foo := filepath.Join(dir, "BUILD"), filepath.Join(dir, "example.com/baz/BUILD"), filepath.Join(dir, "example.com/foo/BUILD")
+	require.Equal(t, []string{
+		flat + ":1: example.com/foo is defined in more than one place: " + flat + ", " + foo + ". Run go-deps to merge them into one.",
+		flat + ":1: go_module() rules depend on each other in a cycle: //" + dir + ":foo -> //" + dir + ":bar -> //" + dir + ":foo. Run go-deps on these modules to split them into parts that don't.",
+		flat + ":7: deps of foo is //" + dir + ":missing, which doesn't exist. Remove it, or point it at the rule that replaced it.",
+		flat + ":21: download of qux is //" + dir + ":qux_dl, which doesn't exist. Add a go_mod_download() rule for example.com/qux, or set the version on qux instead.",
+		flat + ":27: download of quux is //" + dir + ":bar, which is a go_module() rather than a go_mod_download()",
+		baz + ":5: deps of baz is //" + dir + "/example.com/nope:nope, which doesn't exist. Remove it, or point it at the rule that replaced it.",
+		foo + ":1: example.com/foo is defined in more than one place: " + flat + ", " + foo + ". Run go-deps to merge them into one.",
+	}, problems)
+}
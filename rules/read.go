@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/tatskaari/go-deps/journal"
 	"github.com/tatskaari/go-deps/resolve"
 	"github.com/tatskaari/go-deps/resolve/model"
 
@@ -19,6 +20,19 @@ type BuildGraph struct {
 	Files    map[string]*BuildFile
 
 	BuildFileName string
+	// Backend reads and writes the rules for the build system in use. Defaults to Please.
+	Backend Backend
+	// GoRepo is set to write go_repo() rules rather than go_module() rules. This is set when reading any go_repo() rules.
+	GoRepo bool
+	// Journal backs up the files before they're changed, so the changes can be undone. Nothing is backed up if it's nil.
+	Journal *journal.Journal
+
+	// The rules that have been renamed, from their old label to their new label
+	renames map[string]string
+	// The labels of the rules that download a module, which need their hashes computing
+	needsHash map[string]struct{}
+	// The files that have had all their rules moved out of them, which are deleted when the graph is written
+	removedFiles map[string]struct{}
 }
 
 type BuildFile struct {
@@ -26,9 +40,12 @@ type BuildFile struct {
 	ModRules         map[*model.ModulePart]*build.Rule
 	ModDownloadRules map[*model.Module]*build.Rule
 
+	// The rule names in use in this file, mapped to the module the rule is for. Names used by other rules are mapped to
+	// an empty string, so they're never reused for a module.
 	usedNames     map[string]string
 	partNames     map[*model.ModulePart]string
 	downloadNames map[*model.Module]string
+	moduleNames   map[*model.Module]string
 }
 
 func NewGraph(buildFileName string) *BuildGraph {
@@ -41,13 +58,17 @@ func NewGraph(buildFileName string) *BuildGraph {
 		ModFiles:      map[*model.Module]*BuildFile{},
 		Files:         map[string]*BuildFile{},
 		BuildFileName: buildFileName,
+		Backend:       PleaseBackend{},
+		renames:       map[string]string{},
+		needsHash:     map[string]struct{}{},
+		removedFiles:  map[string]struct{}{},
 	}
 }
 
-func newFile(path string) (*BuildFile, error) {
+func (g *BuildGraph) newFile(path string) (*BuildFile, error) {
 	// Ignore errors here as the file doesn't have to exist
 	data, _ := os.ReadFile(path)
-	f, err := build.ParseBuild(path, data)
+	f, err := g.Backend.Parse(path, data)
 	if err != nil {
 		return nil, err
 	}
@@ -60,21 +81,60 @@ func newFile(path string) (*BuildFile, error) {
 		usedNames:     map[string]string{},
 		downloadNames: map[*model.Module]string{},
 		partNames:     map[*model.ModulePart]string{},
+		moduleNames:   map[*model.Module]string{},
 	}, nil
 }
 
+// ReadRules reads the modules from the third party rules in the file into the graph, using the graph's backend
 func (g *BuildGraph) ReadRules(buildFile string) error {
-	file, err := newFile(buildFile)
+	file, err := g.newFile(buildFile)
 	if err != nil {
 		return err
 	}
 
 	g.Files[buildFile] = file
-	for _, rule := range file.File.Rules("go_module") {
+	for _, rule := range file.File.Rules("") {
+		file.usedNames[rule.Name()] = ""
+	}
+	return g.Backend.Read(g, file)
+}
+
+// Parse parses a Please BUILD file
+func (PleaseBackend) Parse(path string, data []byte) (*build.File, error) {
+	return build.ParseBuild(path, data)
+}
+
+// Read reads the go_module(), go_repo() and go_mod_download() rules in the file
+func (PleaseBackend) Read(g *BuildGraph, file *BuildFile) error {
+	downloads := map[string]*build.Rule{}
+	for _, rule := range file.File.Rules("go_mod_download") {
+		downloads[rule.Name()] = rule
+	}
+	// The modules downloaded by each go_mod_download() rule, keyed by the rule's name
+	downloadModules := map[string]*model.Module{}
+
+	for _, rule := range file.File.Rules("") {
+		switch rule.Kind() {
+		case "go_module":
+		case "go_repo":
+			g.GoRepo = true
+		default:
+			continue
+		}
 		moduleName := rule.AttrString("module")
 
-		module := g.Modules.GetModule(resolve.ModuleKey{Path: moduleName})
+		// If the module is downloaded from another module, it's been replaced by it
+		key := resolve.ModuleKey{Path: moduleName}
+		dlRule, ok := downloads[strings.TrimPrefix(rule.AttrString("download"), ":")]
+		if ok && dlRule.AttrString("module") != moduleName {
+			key.Replace = dlRule.AttrString("module")
+		}
+
+		module := g.Modules.GetModule(key)
 		g.ModFiles[module] = file
+		if dlRule != nil {
+			downloadModules[dlRule.Name()] = module
+		}
 
 		pkgs := map[*packages.Package]struct{}{}
 		part := &model.ModulePart{
@@ -85,11 +145,16 @@ func (g *BuildGraph) ReadRules(buildFile string) error {
 		file.ModRules[part] = rule
 		file.usedNames[rule.Name()] = part.Module.Name
 		file.partNames[part] = rule.Name()
+		// The other parts are named by adding a hash to the module's name, so it's the shortest of their names
+		if name, ok := file.moduleNames[module]; !ok || len(rule.Name()) < len(name) {
+			file.moduleNames[module] = rule.Name()
+		}
 
 		module.Version = rule.AttrString("version")
 
 		install := getStrListList(rule, "install")
-		if len(install) == 0 {
+		// go_module() installs the root package by default, but go_repo() doesn't install anything
+		if len(install) == 0 && rule.Kind() == "go_module" {
 			install = []string{"."}
 		}
 		for _, i := range install {
@@ -104,6 +169,9 @@ func (g *BuildGraph) ReadRules(buildFile string) error {
 
 			pkg := g.Modules.GetPackage(importPath)
 			pkg.Module = &packages.Module{Path: module.Name}
+			if key.Replace != "" {
+				pkg.Module.Replace = &packages.Module{Path: key.Replace}
+			}
 
 			part.Packages[pkg] = struct{}{}
 			g.Modules.ImportPaths[pkg] = part
@@ -114,10 +182,13 @@ func (g *BuildGraph) ReadRules(buildFile string) error {
 
 	for _, rule := range file.File.Rules("go_mod_download") {
 		moduleName := rule.AttrString("module")
-		module := g.Modules.GetModule(resolve.ModuleKey{Path: moduleName})
+		module, ok := downloadModules[rule.Name()]
+		if !ok {
+			module = g.Modules.GetModule(resolve.ModuleKey{Path: moduleName})
+		}
 		file.ModDownloadRules[module] = rule
 
-		file.usedNames[rule.Name()] = moduleName
+		file.usedNames[rule.Name()] = module.Name
 		file.downloadNames[module] = rule.Name()
 
 		module.Version = rule.AttrString("version")
@@ -126,6 +197,24 @@ func (g *BuildGraph) ReadRules(buildFile string) error {
 	return nil
 }
 
+// Licences returns the licences set on the rules for the module i.e. on its namesake, or its go_mod_download() rule if
+// the namesake doesn't have any
+func (g *BuildGraph) Licences(m *model.Module) []string {
+	file, ok := g.ModFiles[m]
+	if !ok || len(m.Parts) == 0 {
+		return nil
+	}
+	if rule, ok := file.ModRules[m.Parts[len(m.Parts)-1]]; ok {
+		if licences := getStrListList(rule, "licences"); len(licences) > 0 {
+			return licences
+		}
+	}
+	if rule, ok := file.ModDownloadRules[m]; ok {
+		return getStrListList(rule, "licences")
+	}
+	return nil
+}
+
 func getStrListList(rule *build.Rule, attr string) []string {
 	list, ok := rule.Attr(attr).(*build.ListExpr)
 	if !ok {
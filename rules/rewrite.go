@@ -0,0 +1,211 @@
+package rules
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/buildtools/build"
+
+	"github.com/tatskaari/go-deps/journal"
+)
+
+// RewrittenFile is a first party BUILD file that had references to renamed third party rules updated
+type RewrittenFile struct {
+	Path string
+	// The number of references that were updated
+	Labels int
+}
+
+// retiredLabels returns the renames for the labels that no longer refer to a go_module() rule, following any chains of
+// renames to the final label. Labels that still refer to a go_module() are left as is, as references to them are
+// still correct.
+func (g *BuildGraph) retiredLabels() map[string]string {
+	live := g.PartsByLabel()
+
+	ret := map[string]string{}
+	for from := range g.renames {
+		if _, ok := live[from]; ok {
+			continue
+		}
+		to := g.renames[from]
+		for i := 0; i < len(g.renames); i++ {
+			next, ok := g.renames[to]
+			if !ok {
+				break
+			}
+			if _, ok := live[to]; ok {
+				break
+			}
+			to = next
+		}
+		ret[from] = to
+	}
+	return ret
+}
+
+// UpdateFirstPartyDeps finds references to third party rules that have been renamed or moved in the BUILD files under
+// root, and rewrites them to their new labels. The third party folder is skipped as those files are updated by Format.
+// The files are added to the transaction, so they can be written along with the third party rules, or aren't written at
+// all if it's nil. Returns the files that were, or would be, changed.
+func (g *BuildGraph) UpdateFirstPartyDeps(root, thirdPartyFolder string, tx *journal.Transaction) ([]RewrittenFile, error) {
+	renames := g.retiredLabels()
+	if len(renames) == 0 {
+		return nil, nil
+	}
+
+	var ret []RewrittenFile
+	err := g.editFirstPartyFiles(root, thirdPartyFolder, tx, func(pkg string, f *build.File) (bool, error) {
+		if n := rewriteLabels(f, pkg, renames); n > 0 {
+			ret = append(ret, RewrittenFile{Path: f.Path, Labels: n})
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// editFirstPartyFiles parses each BUILD file under root, apart from those in the third party folder, and passes it to
+// the edit function along with the package it defines. The files are visited in order of their path. If the edit
+// function returns true, the file has been changed, and is added to the transaction if there is one. The files are
+// only written when the transaction is committed, so either all of them are changed, or none are.
+func (g *BuildGraph) editFirstPartyFiles(root, thirdPartyFolder string, tx *journal.Transaction, edit func(pkg string, f *build.File) (bool, error)) error {
+	thirdPartyFolder, err := relativeTo(root, thirdPartyFolder)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			if d.Name() == "plz-out" || strings.HasPrefix(d.Name(), ".") || rel == thirdPartyFolder {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != g.BuildFileName {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f, err := build.ParseBuild(rel, data)
+		if err != nil {
+			return err
+		}
+
+		pkg := filepath.Dir(rel)
+		if pkg == "." {
+			pkg = ""
+		}
+		changed, err := edit(pkg, f)
+		if err != nil || !changed || tx == nil {
+			return err
+		}
+		tx.WriteFile(path, build.Format(f), 0644)
+		return nil
+	})
+}
+
+// relativeTo returns the path relative to root. Paths that aren't absolute are already relative to root.
+func relativeTo(root, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absRoot, path)
+}
+
+// rewriteLabels updates any labels in the rules in the file that have been renamed, returning how many were changed
+func rewriteLabels(f *build.File, pkg string, renames map[string]string) int {
+	count := 0
+	for _, rule := range f.Rules("") {
+		count += relabel(rule, pkg, pkg, renames)
+	}
+	return count
+}
+
+// relabel updates the labels in the rule's attributes for it being moved from one package to another, returning how
+// many were changed. Labels that have been renamed are replaced with their new label. If the rule is staying in the
+// same package, other labels are left as they are.
+func relabel(rule *build.Rule, fromPkg, toPkg string, renames map[string]string) int {
+	count := 0
+	for _, attr := range rule.Call.List {
+		assign, ok := attr.(*build.AssignExpr)
+		if !ok {
+			continue
+		}
+		changed := false
+		build.Walk(assign.RHS, func(expr build.Expr, _ []build.Expr) {
+			str, ok := expr.(*build.StringExpr)
+			if !ok || !(strings.HasPrefix(str.Value, "//") || strings.HasPrefix(str.Value, ":")) {
+				return
+			}
+			label, ok := renames[absoluteLabel(fromPkg, str.Value)]
+			if !ok {
+				if fromPkg == toPkg {
+					return
+				}
+				label = absoluteLabel(fromPkg, str.Value)
+			}
+			str.Value = shortLabel(toPkg, label, !strings.Contains(str.Value, ":"))
+			changed = true
+			count++
+		})
+		if list, ok := assign.RHS.(*build.ListExpr); ok && changed {
+			dedupeLabels(toPkg, list)
+		}
+	}
+	return count
+}
+
+// dedupeLabels removes any labels that now appear in the list more than once
+func dedupeLabels(pkg string, list *build.ListExpr) {
+	done := map[string]struct{}{}
+	newList := make([]build.Expr, 0, len(list.List))
+	for _, expr := range list.List {
+		if str, ok := expr.(*build.StringExpr); ok {
+			label := absoluteLabel(pkg, str.Value)
+			if _, ok := done[label]; ok {
+				continue
+			}
+			done[label] = struct{}{}
+		}
+		newList = append(newList, expr)
+	}
+	list.List = newList
+}
+
+// shortLabel returns the label in the form it should be written in the given package. If short is true, labels like
+// //foo/bar:bar are written as //foo/bar.
+func shortLabel(pkg, label string, short bool) string {
+	label = relativeLabel(pkg, label)
+	if !short || !strings.HasPrefix(label, "//") {
+		return label
+	}
+	i := strings.LastIndex(label, ":")
+	if i < 0 || filepath.Base(label[:i]) != label[i+1:] {
+		return label
+	}
+	return label[:i]
+}
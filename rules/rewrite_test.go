@@ -0,0 +1,65 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/journal"
+)
+
+func TestUpdateFirstPartyDeps(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "src/BUILD", `go_library(
+    name = "src",
+    srcs = ["src.go"],
+    deps = [
+        "//third_party/go:foo",
+        "//third_party/go:foo_1",
+        "//third_party/go/example.com/bar",
+    ],
+)
+`)
+	writeFile(t, root, "plz-out/gen/BUILD", `filegroup(name = "gen", deps = ["//third_party/go:foo_1"])`)
+	writeFile(t, root, "unchanged/BUILD", `go_library(name = "unchanged", deps = ["//third_party/go:foo"])`)
+	writeFile(t, root, "third_party/go/BUILD", `go_module(name = "bar", deps = [":foo_1"])`)
+
+	g := NewGraph("BUILD")
+	g.renames = map[string]string{
+		"//third_party/go:foo_1":                       "//third_party/go:foo",
+		"//third_party/go/example.com/bar:bar":         "//third_party/go/example.com/bar:bar_1a2b3c4",
+		"//third_party/go/example.com/bar:bar_1a2b3c4": "//third_party/go/example.com/baz:baz",
+	}
+
+	files, err := g.UpdateFirstPartyDeps(root, "third_party/go", nil)
+	require.NoError(t, err)
+	require.Equal(t, []RewrittenFile{{Path: "src/BUILD", Labels: 2}}, files)
+
+	// The third party folder is skipped however it's given
+	files, err = g.UpdateFirstPartyDeps(root, filepath.Join(root, "third_party/go"), nil)
+	require.NoError(t, err)
+	require.Equal(t, []RewrittenFile{{Path: "src/BUILD", Labels: 2}}, files)
+
+	data, err := os.ReadFile(filepath.Join(root, "src/BUILD"))
+	require.NoError(t, err)
+	require.Contains(t, string(data), "//third_party/go:foo_1", "files shouldn't be changed unless we're writing")
+
+	tx := journal.NewTransaction(nil)
+	_, err = g.UpdateFirstPartyDeps(root, "third_party/go", tx)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+
+	data, err = os.ReadFile(filepath.Join(root, "src/BUILD"))
+	require.NoError(t, err)
+	require.Equal(t, `go_library(
+    name = "src",
+    srcs = ["src.go"],
+    deps = [
+        "//third_party/go:foo",
+        "//third_party/go/example.com/baz",
+    ],
+)
+`, string(data))
+}
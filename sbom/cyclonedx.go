@@ -0,0 +1,127 @@
+package sbom
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tatskaari/go-deps/licence"
+)
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	Purl       string        `json:"purl,omitempty"`
+	Licenses   []cdxLicense  `json:"licenses,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// cdxLicense is either a single licence, or an SPDX expression
+type cdxLicense struct {
+	License    *cdxLicenseID `json:"license,omitempty"`
+	Expression string        `json:"expression,omitempty"`
+}
+
+type cdxLicenseID struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// cdxLicences returns the licences of the component. Single licences are given by ID, and compound ones as an
+// expression. Anything that isn't valid SPDX is given by name.
+func cdxLicences(l string) []cdxLicense {
+	switch {
+	case l == "":
+		return nil
+	case !licence.IsExpression(l):
+		return []cdxLicense{{License: &cdxLicenseID{Name: l}}}
+	case len(strings.Fields(l)) > 1:
+		return []cdxLicense{{Expression: l}}
+	}
+	return []cdxLicense{{License: &cdxLicenseID{ID: l}}}
+}
+
+// writeCycloneDX writes the SBOM as a CycloneDX 1.5 JSON document. The module the SBOM is for is the metadata
+// component, and depends on the third party modules nothing else depends on.
+func writeCycloneDX(w io.Writer, s *SBOM) error {
+	root := "pkg:golang/" + s.Name
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + s.ID,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: s.Created.Format(time.RFC3339),
+			Tools: cdxTools{
+				Components: []cdxComponent{{Type: "application", Name: "go-deps"}},
+			},
+			Component: cdxComponent{Type: "application", BOMRef: root, Name: s.Name},
+		},
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{},
+	}
+
+	// Replaced modules are identified by the purl of the module that replaces them, which can be in the SBOM too, so
+	// the components are referred to by their ref rather than their purl
+	rootDeps := cdxDependency{Ref: root, DependsOn: []string{}}
+	for _, c := range s.roots() {
+		rootDeps.DependsOn = append(rootDeps.DependsOn, c.Ref())
+	}
+	bom.Dependencies = append(bom.Dependencies, rootDeps)
+
+	for _, c := range s.Components {
+		component := cdxComponent{
+			Type:     "library",
+			BOMRef:   c.Ref(),
+			Name:     c.Path,
+			Version:  c.Version,
+			Purl:     c.Purl(),
+			Licenses: cdxLicences(c.Licence),
+		}
+		for _, h := range c.Hashes {
+			component.Properties = append(component.Properties, cdxProperty{Name: pleaseHashName, Value: h})
+		}
+		bom.Components = append(bom.Components, component)
+
+		dep := cdxDependency{Ref: c.Ref(), DependsOn: []string{}}
+		dep.DependsOn = append(dep.DependsOn, c.DependsOn...)
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bom)
+}
@@ -0,0 +1,171 @@
+// Package sbom exports the third party modules as a software bill of materials, in the SPDX or CycloneDX JSON formats
+package sbom
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tatskaari/go-deps/licence"
+	"github.com/tatskaari/go-deps/resolve/model"
+	"github.com/tatskaari/go-deps/rules"
+)
+
+// Formats are the formats the SBOM can be written in
+var Formats = []string{"spdx", "cyclonedx"}
+
+// Component is a module in the SBOM
+type Component struct {
+	// Path is the module path
+	Path    string
+	Version string
+	// Replace is the module that replaces this one, if any
+	Replace string
+	// Licence is the SPDX expression for the module's licences, or empty if it's unknown
+	Licence string
+	// Hashes are the hashes of the rule that downloads the module, where they're known. These are Please's hashes of the
+	// rule's outputs, not digests of an archive anyone else can download, so they're not given as checksums.
+	Hashes []string
+	// DependsOn are the refs of the modules this one depends on, sorted
+	DependsOn []string
+}
+
+// Ref identifies the component in the SBOM. A module and the same module replaced by another can both be in the graph,
+// so it's the module path, followed by the module that replaces it, if any e.g. example.com/foo=>example.com/fork/foo.
+func (c *Component) Ref() string {
+	return moduleRef(c.Path, c.Replace)
+}
+
+func moduleRef(path, replace string) string {
+	if replace == "" {
+		return path
+	}
+	return path + "=>" + replace
+}
+
+// Purl returns the package URL for the module e.g. pkg:golang/github.com/foo/bar@v1.0.0. Modules replaced by another
+// remote module are identified by the module they're replaced with, as that's the code that's used.
+func (c *Component) Purl() string {
+	path := c.Path
+	if c.Replace != "" && !isLocalPath(c.Replace) {
+		path = c.Replace
+	}
+	purl := "pkg:golang/" + path
+	if c.Version != "" {
+		purl += "@" + url.QueryEscape(c.Version)
+	}
+	return purl
+}
+
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, ".") || strings.HasPrefix(path, "/")
+}
+
+// SBOM is a bill of materials for the third party modules used by a module
+type SBOM struct {
+	// Name is the path of the module the SBOM is for
+	Name string
+	// Created is when the SBOM was generated
+	Created time.Time
+	// ID uniquely identifies this SBOM. It's used as the document namespace, or serial number.
+	ID string
+	// Components are the third party modules, sorted by ref
+	Components []*Component
+}
+
+// New builds the SBOM for the module from the modules in the build graph. Only the modules passed in are included, and
+// their dependencies on each other.
+func New(name string, buildGraph *rules.BuildGraph, mods []*model.Module) *SBOM {
+	included := map[*model.Module]struct{}{}
+	for _, m := range mods {
+		if m.Name != name {
+			included[m] = struct{}{}
+		}
+	}
+
+	parts := buildGraph.PartsByLabel()
+	ret := &SBOM{Name: name, Created: time.Now().UTC(), ID: newUUID()}
+	for _, m := range mods {
+		if _, ok := included[m]; !ok {
+			continue
+		}
+		c := &Component{
+			Path:    m.Name,
+			Version: m.Version,
+			Replace: m.ReplacedBy,
+			Licence: m.Licence,
+			Hashes:  buildGraph.ModuleHashes(m),
+		}
+		if licences := buildGraph.Licences(m); len(licences) > 0 {
+			c.Licence = licence.Or(licences...)
+		}
+
+		dependsOn := map[string]struct{}{}
+		for _, part := range m.Parts {
+			deps, exportedDeps := buildGraph.PartDeps(part)
+			for _, label := range append(deps, exportedDeps...) {
+				dep, ok := parts[label]
+				if !ok || dep.Module == m {
+					continue
+				}
+				if _, ok := included[dep.Module]; ok {
+					dependsOn[moduleRef(dep.Module.Name, dep.Module.ReplacedBy)] = struct{}{}
+				}
+			}
+		}
+		for ref := range dependsOn {
+			c.DependsOn = append(c.DependsOn, ref)
+		}
+		sort.Strings(c.DependsOn)
+		ret.Components = append(ret.Components, c)
+	}
+	sort.Slice(ret.Components, func(i, j int) bool {
+		return ret.Components[i].Ref() < ret.Components[j].Ref()
+	})
+	return ret
+}
+
+// roots returns the components that no other component depends on. These are the direct dependencies of the module the
+// SBOM is for, as far as we can tell from the third party rules.
+func (s *SBOM) roots() []*Component {
+	depended := map[string]struct{}{}
+	for _, c := range s.Components {
+		for _, dep := range c.DependsOn {
+			depended[dep] = struct{}{}
+		}
+	}
+	var ret []*Component
+	for _, c := range s.Components {
+		if _, ok := depended[c.Ref()]; !ok {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+// Write writes the SBOM in the format, which is one of Formats
+func Write(w io.Writer, format string, s *SBOM) error {
+	switch format {
+	case "spdx":
+		return writeSPDX(w, s)
+	case "cyclonedx":
+		return writeCycloneDX(w, s)
+	}
+	return fmt.Errorf("unknown SBOM format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// pleaseHashName names the Please output hashes in the SBOM
+const pleaseHashName = "please:output-hash"
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
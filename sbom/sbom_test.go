@@ -0,0 +1,172 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tatskaari/go-deps/resolve"
+	"github.com/tatskaari/go-deps/resolve/model"
+	"github.com/tatskaari/go-deps/rules"
+)
+
+const buildFile = `
+go_module(
+    name = "a",
+    module = "example.com/a",
+    version = "v1.0.0",
+    licences = ["MIT", "Apache-2.0"],
+    hashes = ["2d4a1c0f7e9b3a5d6c8e1f2a3b4c5d6e7f8a9b0c"],
+    deps = [":b"],
+)
+
+go_mod_download(
+    name = "b_dl",
+    module = "example.org/b",
+    version = "v2.0.0+incompatible",
+    licences = ["BSD-3-Clause"],
+    hashes = ["sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"],
+)
+
+go_module(
+    name = "b",
+    module = "example.com/b",
+    download = ":b_dl",
+    deps = [":c"],
+)
+
+go_module(
+    name = "c",
+    module = "example.com/c",
+    version = "v1.0.0",
+    licences = ["Some bespoke licence"],
+)
+`
+
+func readSBOM(t *testing.T, modules ...string) *SBOM {
+	path := filepath.Join(t.TempDir(), "BUILD")
+	require.NoError(t, os.WriteFile(path, []byte(buildFile), 0644))
+
+	buildGraph := rules.NewGraph("BUILD")
+	require.NoError(t, buildGraph.ReadRules(path))
+
+	var mods []*model.Module
+	for _, m := range buildGraph.Modules.SortedMods() {
+		if len(modules) == 0 || contains(modules, m.Name) {
+			mods = append(mods, m)
+		}
+	}
+	s := New("example.com/root", buildGraph, mods)
+	s.Created = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.ID = "00000000-0000-4000-8000-000000000000"
+	return s
+}
+
+func TestNew(t *testing.T) {
+	s := readSBOM(t)
+	require.Len(t, s.Components, 3)
+
+	a, b, c := s.Components[0], s.Components[1], s.Components[2]
+	require.Equal(t, "MIT OR Apache-2.0", a.Licence)
+	require.Equal(t, []string{"example.com/b=>example.org/b"}, a.DependsOn)
+	require.Equal(t, "pkg:golang/example.com/a@v1.0.0", a.Purl())
+
+	require.Equal(t, "example.org/b", b.Replace)
+	require.Equal(t, "pkg:golang/example.org/b@v2.0.0%2Bincompatible", b.Purl())
+	require.Equal(t, "BSD-3-Clause", b.Licence)
+	require.Equal(t, []string{"example.com/c"}, b.DependsOn)
+	require.Empty(t, c.DependsOn)
+
+	require.Equal(t, []*Component{a}, s.roots())
+
+	// Deps on modules that aren't included are dropped
+	s = readSBOM(t, "example.com/a", "example.com/c")
+	require.Len(t, s.Components, 2)
+	require.Empty(t, s.Components[0].DependsOn)
+}
+
+func TestNewKeepsReplacedModulesApart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "BUILD")
+	require.NoError(t, os.WriteFile(path, []byte(buildFile), 0644))
+	buildGraph := rules.NewGraph("BUILD")
+	require.NoError(t, buildGraph.ReadRules(path))
+	buildGraph.Modules.GetModule(resolve.ModuleKey{Path: "example.com/b"}).Version = "v1.5.0"
+
+	s := New("example.com/root", buildGraph, buildGraph.Modules.SortedMods())
+	require.Len(t, s.Components, 4)
+	b, replaced := s.Components[1], s.Components[2]
+	require.Equal(t, "example.com/b", b.Ref())
+	require.Equal(t, "v1.5.0", b.Version)
+	require.Equal(t, "example.com/b=>example.org/b", replaced.Ref())
+	require.Equal(t, "v2.0.0+incompatible", replaced.Version)
+	require.NotEqual(t, spdxID(b.Ref()), spdxID(replaced.Ref()))
+}
+
+func contains(ss []string, s string) bool {
+	for _, i := range ss {
+		if i == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWriteSPDX(t *testing.T) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, Write(buf, "spdx", readSBOM(t)))
+
+	var doc spdxDocument
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	require.Equal(t, "SPDX-2.3", doc.SPDXVersion)
+	require.Equal(t, "2026-01-02T03:04:05Z", doc.CreationInfo.Created)
+	require.Len(t, doc.Packages, 4)
+
+	a := doc.Packages[1]
+	require.Equal(t, "SPDXRef-Package-example.com-a", a.SPDXID)
+	require.Equal(t, "MIT OR Apache-2.0", a.LicenseDeclared)
+	require.Equal(t, []spdxAnnotation{{
+		AnnotationDate: "2026-01-02T03:04:05Z",
+		AnnotationType: "OTHER",
+		Annotator:      "Tool: go-deps",
+		Comment:        "please:output-hash: 2d4a1c0f7e9b3a5d6c8e1f2a3b4c5d6e7f8a9b0c",
+	}}, a.Annotations)
+	require.Equal(t, "pkg:golang/example.com/a@v1.0.0", a.ExternalRefs[0].ReferenceLocator)
+	require.Equal(t, noAssertion, doc.Packages[3].LicenseDeclared)
+
+	require.Equal(t, []spdxRelationship{
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Package-example.com-root"},
+		{SPDXElementID: "SPDXRef-Package-example.com-a", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: "SPDXRef-Package-example.com-b--example.org-b"},
+		{SPDXElementID: "SPDXRef-Package-example.com-b--example.org-b", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: "SPDXRef-Package-example.com-c"},
+		{SPDXElementID: "SPDXRef-Package-example.com-root", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: "SPDXRef-Package-example.com-a"},
+	}, doc.Relationships)
+}
+
+func TestWriteCycloneDX(t *testing.T) {
+	buf := new(bytes.Buffer)
+	require.NoError(t, Write(buf, "cyclonedx", readSBOM(t)))
+
+	var bom cdxBOM
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &bom))
+	require.Equal(t, "1.5", bom.SpecVersion)
+	require.Equal(t, "urn:uuid:00000000-0000-4000-8000-000000000000", bom.SerialNumber)
+	require.Len(t, bom.Components, 3)
+
+	require.Equal(t, []cdxLicense{{Expression: "MIT OR Apache-2.0"}}, bom.Components[0].Licenses)
+	require.Equal(t, []cdxLicense{{License: &cdxLicenseID{ID: "BSD-3-Clause"}}}, bom.Components[1].Licenses)
+	require.Equal(t, []cdxProperty{{Name: "please:output-hash", Value: "sha256: 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}}, bom.Components[1].Properties)
+	require.Equal(t, []cdxLicense{{License: &cdxLicenseID{Name: "Some bespoke licence"}}}, bom.Components[2].Licenses)
+
+	require.Equal(t, []cdxDependency{
+		{Ref: "pkg:golang/example.com/root", DependsOn: []string{"example.com/a"}},
+		{Ref: "example.com/a", DependsOn: []string{"example.com/b=>example.org/b"}},
+		{Ref: "example.com/b=>example.org/b", DependsOn: []string{"example.com/c"}},
+		{Ref: "example.com/c", DependsOn: []string{}},
+	}, bom.Dependencies)
+
+	require.Error(t, Write(buf, "swid", readSBOM(t)))
+}
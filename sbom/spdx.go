@@ -0,0 +1,152 @@
+package sbom
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/tatskaari/go-deps/licence"
+)
+
+// noAssertion is used in SPDX documents for values we don't know
+const noAssertion = "NOASSERTION"
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Annotations      []spdxAnnotation  `json:"annotations,omitempty"`
+}
+
+type spdxAnnotation struct {
+	AnnotationDate string `json:"annotationDate"`
+	AnnotationType string `json:"annotationType"`
+	Annotator      string `json:"annotator"`
+	Comment        string `json:"comment"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// invalidSPDXIDChars matches the characters that aren't allowed in SPDX IDs
+var invalidSPDXIDChars = regexp.MustCompile(`[^A-Za-z0-9.-]`)
+
+// spdxID returns the SPDX ID for the module path or component ref
+func spdxID(ref string) string {
+	return "SPDXRef-Package-" + invalidSPDXIDChars.ReplaceAllString(ref, "-")
+}
+
+// spdxLicence returns the licence for the SPDX document, which must be a valid SPDX expression
+func spdxLicence(l string) string {
+	if l == "" || !licence.IsExpression(l) {
+		return noAssertion
+	}
+	return l
+}
+
+// writeSPDX writes the SBOM as an SPDX 2.3 JSON document. The document describes the module the SBOM is for, which
+// depends on the third party modules nothing else depends on.
+func writeSPDX(w io.Writer, s *SBOM) error {
+	root := spdxID(s.Name)
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              s.Name,
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + invalidSPDXIDChars.ReplaceAllString(s.Name, "-") + "-" + s.ID,
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Created.Format(time.RFC3339),
+			Creators: []string{"Tool: go-deps"},
+		},
+		Packages: []spdxPackage{{
+			Name:             s.Name,
+			SPDXID:           root,
+			DownloadLocation: noAssertion,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+		}},
+		Relationships: []spdxRelationship{{
+			SPDXElementID:      "SPDXRef-DOCUMENT",
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: root,
+		}},
+	}
+
+	for _, c := range s.Components {
+		pkg := spdxPackage{
+			Name:             c.Path,
+			SPDXID:           spdxID(c.Ref()),
+			VersionInfo:      c.Version,
+			DownloadLocation: noAssertion,
+			LicenseConcluded: spdxLicence(c.Licence),
+			LicenseDeclared:  spdxLicence(c.Licence),
+			CopyrightText:    noAssertion,
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  c.Purl(),
+			}},
+		}
+		for _, h := range c.Hashes {
+			pkg.Annotations = append(pkg.Annotations, spdxAnnotation{
+				AnnotationDate: doc.CreationInfo.Created,
+				AnnotationType: "OTHER",
+				Annotator:      "Tool: go-deps",
+				Comment:        pleaseHashName + ": " + h,
+			})
+		}
+		doc.Packages = append(doc.Packages, pkg)
+
+		for _, dep := range c.DependsOn {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{
+				SPDXElementID:      spdxID(c.Ref()),
+				RelationshipType:   "DEPENDS_ON",
+				RelatedSPDXElement: spdxID(dep),
+			})
+		}
+	}
+	for _, c := range s.roots() {
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      root,
+			RelationshipType:   "DEPENDS_ON",
+			RelatedSPDXElement: spdxID(c.Ref()),
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
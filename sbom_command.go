@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/tatskaari/go-deps/sbom"
+	"github.com/tatskaari/go-deps/scan"
+)
+
+type sbomCommand struct {
+	Format string `long:"format" short:"f" default:"spdx" choice:"spdx" choice:"cyclonedx" description:"The format to write the SBOM in: SPDX 2.3 or CycloneDX 1.5 JSON."`
+	Out    string `long:"out" short:"o" description:"The file to write the SBOM to. Printed to stdout by default."`
+}
+
+// Execute writes an SBOM for the third party modules. The args are build labels or module paths, and if any are
+// passed, only the modules they depend on are included.
+func (cmd *sbomCommand) Execute(args []string) error {
+	moduleGraph, _, err := parseRules()
+	if err != nil {
+		return err
+	}
+
+	mods, err := reachableModules(moduleGraph, args)
+	if err != nil {
+		return err
+	}
+	name := scan.ModulePath(".")
+	if name == "" {
+		// There's no go.mod or import path in the .plzconfig, so name the SBOM after the repo
+		wd, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		name = filepath.Base(wd)
+	}
+	s := sbom.New(name, moduleGraph, mods)
+
+	return writeOutput(cmd.Out, func(w io.Writer) error {
+		return sbom.Write(w, cmd.Format, s)
+	})
+}
@@ -0,0 +1,142 @@
+// Package scan finds the packages imported by the first party Go code in a repo
+package scan
+
+import (
+	"bufio"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Imports walks the Go sources under root, returning the sorted import paths they use. The given directories are
+// skipped, along with plz-out, vendor, testdata and any hidden directories.
+func Imports(root string, skipDirs ...string) ([]string, error) {
+	skip := map[string]struct{}{}
+	for _, dir := range skipDirs {
+		skip[filepath.Clean(dir)] = struct{}{}
+	}
+
+	imports := map[string]struct{}{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			if _, ok := skip[rel]; ok {
+				return filepath.SkipDir
+			}
+			switch name := d.Name(); {
+			case name == "plz-out", name == "vendor", name == "testdata", strings.HasPrefix(name, "."):
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ".go" {
+			return nil
+		}
+
+		fileImports, err := FileImports(path)
+		if err != nil {
+			return err
+		}
+		for _, i := range fileImports {
+			imports[i] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(imports))
+	for i := range imports {
+		ret = append(ret, i)
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// FileImports returns the import paths used by the Go file
+func FileImports(path string) ([]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(f.Imports))
+	for _, i := range f.Imports {
+		path, err := strconv.Unquote(i.Path.Value)
+		if err != nil {
+			return nil, err
+		}
+		if path != "C" {
+			ret = append(ret, path)
+		}
+	}
+	return ret, nil
+}
+
+// ModulePath returns the import path of the first party code in the repo at root. This is the module path from the
+// go.mod if there is one, otherwise the import path configured in the .plzconfig for the Go plugin. Returns an empty
+// string if neither are set.
+func ModulePath(root string) string {
+	if data, err := os.ReadFile(filepath.Join(root, "go.mod")); err == nil {
+		if path := modfile.ModulePath(data); path != "" {
+			return path
+		}
+	}
+	return plzConfigImportPath(filepath.Join(root, ".plzconfig"))
+}
+
+// plzConfigImportPath reads the import path from the [go] or [plugin "go"] section of the .plzconfig
+func plzConfigImportPath(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.Join(strings.Fields(line[1:len(line)-1]), " "))
+			continue
+		}
+		if section != "go" && section != `plugin "go"` {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), "importpath") {
+			return strings.TrimSpace(parts[1])
+		}
+	}
+	return ""
+}
+
+// IsFirstParty returns true if the import path is for a package in the repo. Paths without a dot in their first
+// element can't be fetched with `go get`, so we assume they're first party too.
+func IsFirstParty(importPath, modulePath string) bool {
+	if modulePath != "" && (importPath == modulePath || strings.HasPrefix(importPath, modulePath+"/")) {
+		return true
+	}
+	first := strings.SplitN(importPath, "/", 2)[0]
+	return !strings.Contains(first, ".")
+}
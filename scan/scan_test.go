@@ -0,0 +1,45 @@
+package scan
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeFile writes the file under root, creating any directories it's in
+func writeFile(t *testing.T, root, path, contents string) {
+	t.Helper()
+	path = filepath.Join(root, path)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0775))
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+}
+
+func TestImports(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "src/foo.go", "package foo\n\nimport (\n\t\"fmt\"\n\t\"github.com/example/bar\"\n)\n")
+	writeFile(t, root, "src/foo_test.go", "package foo\n\nimport \"github.com/stretchr/testify/require\"\n")
+	writeFile(t, root, "third_party/go/baz/baz.go", "package baz\n\nimport \"github.com/example/baz\"\n")
+	writeFile(t, root, "plz-out/gen/gen.go", "package gen\n\nimport \"github.com/example/gen\"\n")
+
+	imports, err := Imports(root, "third_party/go")
+	require.NoError(t, err)
+	require.Equal(t, []string{"fmt", "github.com/example/bar", "github.com/stretchr/testify/require"}, imports)
+}
+
+func TestModulePathFromPlzConfig(t *testing.T) {
+	root := t.TempDir()
+	config := "[please]\nversion = 16.20.0\n\n[Plugin \"go\"]\nTarget = //plugins:go\nImportPath = github.com/example/repo\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".plzconfig"), []byte(config), 0644))
+
+	require.Equal(t, "github.com/example/repo", ModulePath(root))
+}
+
+func TestIsFirstParty(t *testing.T) {
+	require.True(t, IsFirstParty("github.com/example/repo", "github.com/example/repo"))
+	require.True(t, IsFirstParty("github.com/example/repo/src/foo", "github.com/example/repo"))
+	require.True(t, IsFirstParty("src/foo", ""))
+	require.False(t, IsFirstParty("github.com/example/repository", "github.com/example/repo"))
+	require.False(t, IsFirstParty("github.com/example/bar", ""))
+}
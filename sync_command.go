@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tatskaari/go-deps/scan"
+)
+
+type syncCommand struct{}
+
+func (cmd *syncCommand) Execute(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	if err := requirePlease("sync"); err != nil {
+		return err
+	}
+
+	moduleGraph, structured, err := readRules()
+	if err != nil {
+		return err
+	}
+
+	changes, err := moduleGraph.SyncFirstPartyDeps(".", opts.ThirdPartyFolder, scan.ModulePath("."), structured, opts.Write)
+	if err != nil {
+		return err
+	}
+
+	verb := "Updated"
+	if !opts.Write {
+		verb = "Would update"
+	}
+	for _, change := range changes {
+		if change.Skipped {
+			fmt.Fprintf(os.Stderr, "Skipped %s as its srcs aren't a list of files\n", change.Label)
+			continue
+		}
+		if len(change.Added) > 0 {
+			fmt.Fprintf(os.Stderr, "%s %s: added %s\n", verb, change.Label, strings.Join(change.Added, ", "))
+		}
+		if len(change.Removed) > 0 {
+			fmt.Fprintf(os.Stderr, "%s %s: removed %s\n", verb, change.Label, strings.Join(change.Removed, ", "))
+		}
+		for _, i := range change.Missing {
+			fmt.Fprintf(os.Stderr, "WARNING: %s imports %s, which isn't provided by a go_module(). Run `go-deps fix` to add it.\n", change.Label, i)
+		}
+	}
+	return nil
+}
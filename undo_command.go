@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tatskaari/go-deps/journal"
+)
+
+type undoCommand struct {
+	Force bool `long:"force" description:"Restore the files even if they've been changed since go-deps last wrote them."`
+}
+
+// Execute restores the files changed by the last run of go-deps from its journal, as long as they haven't been changed
+// since
+func (cmd *undoCommand) Execute(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+
+	entries, err := journal.Undo(journal.Dir, cmd.Force)
+	if _, ok := err.(*journal.ChangedError); ok {
+		return fmt.Errorf("%v. Run go-deps undo --force to undo anyway", err)
+	} else if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Backup == "" {
+			fmt.Fprintf(os.Stderr, "Removed %s\n", e.Path)
+		} else {
+			fmt.Fprintf(os.Stderr, "Restored %s\n", e.Path)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Undid the changes to %d file(s)\n", len(entries))
+	return nil
+}
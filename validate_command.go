@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type validateCommand struct{}
+
+// Execute checks the existing third party rules for problems that Please would only report when building them, such as
+// cycles between go_module() rules, deps on rules that don't exist, and download labels that aren't go_mod_download()
+// rules. Each problem is printed with the file and line it's on.
+func (cmd *validateCommand) Execute(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments: %v", args)
+	}
+	if err := requirePlease("validate"); err != nil {
+		return err
+	}
+
+	moduleGraph, _, err := parseRules()
+	if err != nil {
+		return err
+	}
+
+	problems := moduleGraph.Problems(opts.ThirdPartyFolder)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problem(s) with the third party rules in %s", len(problems), opts.ThirdPartyFolder)
+	}
+	fmt.Fprintf(os.Stderr, "No problems found with the third party rules in %s\n", opts.ThirdPartyFolder)
+	return nil
+}